@@ -0,0 +1,78 @@
+package mail
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// isUTF8 reports whether charset is empty or UTF-8, which needs no encoding
+func isUTF8(charset string) bool {
+	return charset == "" || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "utf8")
+}
+
+// charsetEncoding returns the encoding of the IANA charset name
+func charsetEncoding(charset string) (enc encoding.Encoding, err error) {
+	enc, err = ianaindex.MIME.Encoding(charset)
+	if err == nil && enc == nil {
+		err = fmt.Errorf("charset %v is not supported", charset)
+	}
+	if err != nil {
+		err = fmt.Errorf("unknown charset %q: %v", charset, err)
+	}
+
+	return
+}
+
+// charsetEncoder encodes strings from UTF-8 to a charset
+type charsetEncoder struct {
+	charset string
+	encoder *encoding.Encoder
+}
+
+func newCharsetEncoder(charset string) (e charsetEncoder, err error) {
+	enc, err := charsetEncoding(charset)
+	if err != nil {
+		return
+	}
+
+	return charsetEncoder{charset: charset, encoder: enc.NewEncoder()}, nil
+}
+
+func (e charsetEncoder) encode(field, s string) (string, error) {
+	encoded, err := e.encoder.String(s)
+	if err != nil {
+		return "", fmt.Errorf("couldn't encode %v in charset %v: %v", field, e.charset, err)
+	}
+
+	return encoded, nil
+}
+
+// encodeCharset returns message with topic, body and alternatives encoded in message.Charset
+func encodeCharset(message Message) (encoded Message, err error) {
+	e, err := newCharsetEncoder(message.Charset)
+	if err != nil {
+		return
+	}
+
+	encoded = message
+	if encoded.Topic, err = e.encode("topic", message.Topic); err != nil {
+		return
+	}
+
+	if encoded.Body, err = e.encode("body", message.Body); err != nil {
+		return
+	}
+
+	encoded.Alternatives = make([]Alternative, len(message.Alternatives))
+	for i, alt := range message.Alternatives {
+		if alt.Body, err = e.encode("alternative", alt.Body); err != nil {
+			return
+		}
+		encoded.Alternatives[i] = alt
+	}
+
+	return
+}
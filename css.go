@@ -0,0 +1,272 @@
+package mail
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// cssRule is a style rule with a simple selector, e.g. p.note { color: red }
+type cssRule struct {
+	tag         string
+	id          string
+	classes     []string
+	specificity int
+	order       int
+	decls       []string
+}
+
+var (
+	cssCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	// simpleSelectorRe matches selectors which can be inlined: an optional type followed by ids and classes
+	simpleSelectorRe = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*|\*)?((?:[.#][a-zA-Z0-9_-]+)*)$`)
+	selectorPartRe   = regexp.MustCompile(`[.#][a-zA-Z0-9_-]+`)
+)
+
+func (r cssRule) matches(n *html.Node) bool {
+	if r.tag != "" && r.tag != "*" && !strings.EqualFold(r.tag, n.Data) {
+		return false
+	}
+
+	var id string
+	classes := map[string]bool{}
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "id":
+			id = attr.Val
+		case "class":
+			for _, c := range strings.Fields(attr.Val) {
+				classes[c] = true
+			}
+		}
+	}
+
+	if r.id != "" && r.id != id {
+		return false
+	}
+
+	for _, c := range r.classes {
+		if !classes[c] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseStylesheet splits css into rules which can be inlined and the css which has to stay
+// in the stylesheet, like media queries or rules with complex selectors
+func parseStylesheet(css string, order *int) (rules []cssRule, rest string) {
+	css = cssCommentRe.ReplaceAllString(css, "")
+
+	var kept strings.Builder
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			break
+		}
+
+		open := strings.Index(css, "{")
+		if strings.HasPrefix(css, "@") {
+			if semi := strings.Index(css, ";"); semi != -1 && (open == -1 || semi < open) {
+				kept.WriteString(css[:semi+1] + "\n")
+				css = css[semi+1:]
+				continue
+			}
+		}
+
+		if open == -1 {
+			break
+		}
+
+		end := matchingBrace(css, open)
+		if strings.HasPrefix(css, "@") {
+			kept.WriteString(strings.TrimSpace(css[:end]) + "\n")
+			css = css[end:]
+			continue
+		}
+
+		selectors := css[:open]
+		decls := splitDeclarations(css[open+1 : end-1])
+		css = css[end:]
+
+		var unsupported []string
+		for _, selector := range strings.Split(selectors, ",") {
+			selector = strings.TrimSpace(selector)
+			m := simpleSelectorRe.FindStringSubmatch(selector)
+			if selector == "" || m == nil {
+				unsupported = append(unsupported, selector)
+				continue
+			}
+
+			rule := cssRule{tag: m[1], order: *order, decls: decls}
+			if m[1] != "" && m[1] != "*" {
+				rule.specificity = 1
+			}
+			for _, part := range selectorPartRe.FindAllString(m[2], -1) {
+				if part[0] == '#' {
+					rule.id = part[1:]
+					rule.specificity += 100
+				} else {
+					rule.classes = append(rule.classes, part[1:])
+					rule.specificity += 10
+				}
+			}
+
+			*order++
+			rules = append(rules, rule)
+		}
+
+		if len(unsupported) > 0 {
+			kept.WriteString(strings.Join(unsupported, ", ") + " { " + strings.Join(decls, "; ") + " }\n")
+		}
+	}
+
+	return rules, strings.TrimSpace(kept.String())
+}
+
+// matchingBrace returns the index after the brace closing the one at open
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(s)
+}
+
+func splitDeclarations(s string) (decls []string) {
+	for _, decl := range strings.Split(s, ";") {
+		prop, value, ok := strings.Cut(decl, ":")
+		if !ok || strings.TrimSpace(prop) == "" {
+			continue
+		}
+
+		decls = append(decls, strings.TrimSpace(prop)+": "+strings.TrimSpace(value))
+	}
+
+	return
+}
+
+// inlineCSS moves the rules of the <style> elements into style attributes.
+// Rules which can't be inlined, like media queries, stay in the <style> element.
+// Existing style attributes take precedence over the stylesheet.
+func inlineCSS(body string) (s string, err error) {
+	if !strings.Contains(strings.ToLower(body), "<style") {
+		return body, nil
+	}
+
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	var (
+		rules  []cssRule
+		order  int
+		styles []*html.Node
+	)
+
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Style {
+			styles = append(styles, n)
+			return
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(doc)
+
+	for _, style := range styles {
+		var css strings.Builder
+		for c := style.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.TextNode {
+				css.WriteString(c.Data)
+			}
+		}
+
+		parsed, rest := parseStylesheet(css.String(), &order)
+		rules = append(rules, parsed...)
+
+		if rest == "" {
+			style.Parent.RemoveChild(style)
+			continue
+		}
+
+		for style.FirstChild != nil {
+			style.RemoveChild(style.FirstChild)
+		}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: "\n" + rest + "\n"})
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].specificity != rules[j].specificity {
+			return rules[i].specificity < rules[j].specificity
+		}
+
+		return rules[i].order < rules[j].order
+	})
+
+	var apply func(n *html.Node)
+	apply = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom != atom.Head {
+			var decls []string
+			for _, rule := range rules {
+				if rule.matches(n) {
+					decls = append(decls, rule.decls...)
+				}
+			}
+
+			if len(decls) > 0 {
+				setStyle(n, decls)
+			}
+		}
+
+		if n.DataAtom == atom.Head {
+			return
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			apply(c)
+		}
+	}
+	apply(doc)
+
+	var buf strings.Builder
+	if err = html.Render(&buf, doc); err != nil {
+		return
+	}
+
+	return buf.String(), nil
+}
+
+// setStyle prepends decls to the style attribute of n
+func setStyle(n *html.Node, decls []string) {
+	style := strings.Join(decls, "; ")
+
+	for i, attr := range n.Attr {
+		if attr.Key == "style" {
+			if existing := strings.TrimSpace(attr.Val); existing != "" {
+				style += "; " + strings.TrimSuffix(existing, ";")
+			}
+			n.Attr[i].Val = style
+			return
+		}
+	}
+
+	n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: style})
+}
@@ -0,0 +1,60 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestInlineCSS(t *testing.T) {
+	body := `<html><head><style>
+/* base */
+p { color: red; margin: 0 }
+.note { color: blue }
+p#intro { font-weight: bold }
+a:hover { color: green }
+@media (max-width: 600px) { p { font-size: 12px } }
+</style></head>
+<body><p id="intro">Hi {{.Name}}</p><p class="note" style="margin: 4px">Note</p><a href="#">link</a></body></html>`
+
+	tpl, err := mail.NewTemplate("topic", body, mail.ContentType("text/html"), mail.InlineCSS())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(testData{Name: "Ava"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`<p id="intro" style="color: red; margin: 0; font-weight: bold">Hi Ava</p>`,
+		`<p class="note" style="color: red; margin: 0; color: blue; margin: 4px">Note</p>`,
+		`<a href="#">link</a>`,
+		`a:hover { color: green }`,
+		`@media (max-width: 600px) { p { font-size: 12px } }`,
+	} {
+		if !strings.Contains(msg.Body, want) {
+			t.Errorf("expected %q in body:\n%s", want, msg.Body)
+		}
+	}
+
+	if strings.Contains(msg.Body, ".note") {
+		t.Errorf("expected inlined rules to be removed from stylesheet:\n%s", msg.Body)
+	}
+
+	tpl, err = mail.NewMultipartTemplate("topic", "text", `<style>b { color: red }</style><b>html</b>`, mail.InlineCSS())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(msg.Alternatives[0].Body, `<b style="color: red">html</b>`) || strings.Contains(msg.Alternatives[0].Body, "<style>") {
+		t.Errorf("expected inlined html alternative, got:\n%s", msg.Alternatives[0].Body)
+	}
+}
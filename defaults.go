@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// WithDefaults sets values which are merged with the data of Execute, e.g. a product name or the
+// current year in a footer. Values of the data win over defaults with the same name. The data must
+// be a map with string keys or a struct, which is merged by its exported fields, so its methods
+// can't be used in the templates anymore. Several WithDefaults are merged, later values win.
+func WithDefaults(defaults map[string]interface{}) Option {
+	return func(tpl *Template) {
+		merged := make(map[string]interface{}, len(tpl.defaults)+len(defaults))
+		for key, value := range tpl.defaults {
+			merged[key] = value
+		}
+		for key, value := range defaults {
+			merged[key] = value
+		}
+		tpl.defaults = merged
+	}
+}
+
+// mergeDefaults returns a map of defaults overwritten with the values of data
+func mergeDefaults(defaults map[string]interface{}, data interface{}) (merged map[string]interface{}, err error) {
+	merged = make(map[string]interface{}, len(defaults))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case !v.IsValid():
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		iter := v.MapRange()
+		for iter.Next() {
+			merged[iter.Key().String()] = iter.Value().Interface()
+		}
+	case v.Kind() == reflect.Struct:
+		for _, field := range reflect.VisibleFields(v.Type()) {
+			if !field.IsExported() {
+				continue
+			}
+
+			value, fieldErr := v.FieldByIndexErr(field.Index)
+			if fieldErr != nil {
+				// promoted through a nil embedded pointer
+				continue
+			}
+			merged[field.Name] = value.Interface()
+		}
+	default:
+		err = fmt.Errorf("couldn't merge defaults with data of type %T, use a map or a struct", data)
+	}
+
+	return
+}
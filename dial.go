@@ -0,0 +1,461 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	stdmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"gopkg.in/mail.v2"
+)
+
+// smtpSender is a mail.SendCloser like the sender returned by mail.Dialer.Dial,
+// but it can be bound to a context which closes the connection when it's done.
+type smtpSender struct {
+	client  *smtp.Client
+	rawConn net.Conn
+	conn    net.Conn
+	timeout time.Duration
+	// dkim signs the messages when set
+	dkim *dkim.SignOptions
+	// login is the address the connection is authenticated with, servers often only accept it as envelope sender
+	login string
+}
+
+var _ mail.SendCloser = &smtpSender{}
+
+func tlsConfig(d *mail.Dialer) *tls.Config {
+	if d.TLSConfig == nil {
+		return &tls.Config{ServerName: d.Host}
+	}
+
+	return d.TLSConfig
+}
+
+func auth(ctx context.Context, d *mail.Dialer, c *smtp.Client) smtp.Auth {
+	if a, ok := d.Auth.(*xoauth2Auth); ok {
+		return a.withContext(ctx)
+	}
+
+	if d.Auth != nil || d.Username == "" {
+		return d.Auth
+	}
+
+	ok, auths := c.Extension("AUTH")
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case strings.Contains(auths, "CRAM-MD5"):
+		return smtp.CRAMMD5Auth(d.Username, d.Password)
+	case strings.Contains(auths, "LOGIN") && !strings.Contains(auths, "PLAIN"):
+		return &loginAuth{username: d.Username, password: d.Password, host: d.Host}
+	default:
+		return smtp.PlainAuth("", d.Username, d.Password, d.Host)
+	}
+}
+
+// dialContext dials and authenticates like mail.Dialer.Dial. Other than
+// mail.Dialer.Dial the timeout of the dialer covers the smtp greeting as well
+// and dialing is aborted when ctx is done.
+func dialContext(ctx context.Context, d *mail.Dialer, log *slog.Logger) (s *smtpSender, err error) {
+	log = log.With(slog.String("host", d.Host), slog.Int("port", d.Port))
+	log.Debug("dialing smtp server", slog.Bool("ssl", d.SSL))
+	defer func() {
+		if err != nil {
+			err = categorize(err, nil)
+			log.Debug("couldn't connect to smtp server", slog.Any("error", err))
+		}
+	}()
+
+	netDialer := net.Dialer{Timeout: d.Timeout}
+	rawConn, err := netDialer.DialContext(ctx, "tcp", net.JoinHostPort(d.Host, strconv.Itoa(d.Port)))
+	if err != nil {
+		return
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		rawConn.Close()
+	})
+	defer func() {
+		if !stop() && err == nil {
+			err = ctx.Err()
+		}
+
+		if err != nil {
+			rawConn.Close()
+		}
+	}()
+
+	conn := rawConn
+	if d.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.Timeout))
+	}
+
+	if d.SSL {
+		conn = tls.Client(conn, tlsConfig(d))
+	}
+
+	c, err := smtp.NewClient(conn, d.Host)
+	if err != nil {
+		return
+	}
+
+	if d.LocalName != "" {
+		if err = c.Hello(d.LocalName); err != nil {
+			return
+		}
+	}
+
+	if !d.SSL && d.StartTLSPolicy != mail.NoStartTLS {
+		ok, _ := c.Extension("STARTTLS")
+		if !ok && d.StartTLSPolicy == mail.MandatoryStartTLS {
+			err = mail.StartTLSUnsupportedError{Policy: d.StartTLSPolicy}
+			return
+		}
+
+		if ok {
+			if err = c.StartTLS(tlsConfig(d)); err != nil {
+				return
+			}
+		}
+	}
+
+	var login string
+	if a := auth(ctx, d, c); a != nil {
+		log.Debug("authenticating")
+		if err = c.Auth(a); err != nil {
+			err = categorize(err, ErrAuth)
+			return
+		}
+
+		if addr, parseErr := stdmail.ParseAddress(d.Username); parseErr == nil {
+			login = addr.Address
+		}
+	}
+
+	log.Debug("connected to smtp server")
+	return &smtpSender{client: c, rawConn: rawConn, conn: conn, timeout: d.Timeout, login: login}, nil
+}
+
+// bind closes the connection when ctx is done, until stop is called
+func (s *smtpSender) bind(ctx context.Context) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		s.rawConn.Close()
+	})
+}
+
+// send sends the messages while the connection is bound to ctx
+func (s *smtpSender) send(ctx context.Context, m ...*mail.Message) error {
+	stop := s.bind(ctx)
+	defer stop()
+
+	for i, msg := range m {
+		from, to, err := envelope(msg)
+		if err == nil {
+			err = s.Send(from, to, msg)
+		}
+
+		if err != nil {
+			return &sendError{index: i, cause: categorize(err, nil)}
+		}
+	}
+
+	return nil
+}
+
+// sendTo sends m to the envelope recipients to, instead of the recipients of its headers,
+// while the connection is bound to ctx
+func (s *smtpSender) sendTo(ctx context.Context, m *mail.Message, to []string) error {
+	stop := s.bind(ctx)
+	defer stop()
+
+	from, _, err := envelope(m)
+	if err == nil {
+		err = s.Send(from, to, m)
+	}
+
+	if err != nil {
+		return &sendError{index: 0, cause: categorize(err, nil)}
+	}
+
+	return nil
+}
+
+// alive checks whether the connection can still be used
+func (s *smtpSender) alive() bool {
+	if s.timeout > 0 {
+		s.conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	return s.client.Noop() == nil
+}
+
+// dialAndSend opens a connection bound to ctx, sends the given messages signed with
+// signing, when it's not nil, and closes the connection.
+func dialAndSend(ctx context.Context, d *mail.Dialer, log *slog.Logger, signing *dkim.SignOptions, m ...*mail.Message) (err error) {
+	s, err := dialContext(ctx, d, log)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	s.dkim = signing
+
+	return s.send(ctx, m...)
+}
+
+// dialAndSendWith sends the messages over a new connection of d, e.g. a fake dialer in tests.
+// to replaces the envelope recipients of the headers when it's not nil.
+func dialAndSendWith(d dialer, to []string, m ...*mail.Message) (err error) {
+	s, err := d.Dial()
+	if err != nil {
+		return
+	}
+	defer s.Close()
+
+	for i, msg := range m {
+		from, recipients, err := envelope(msg)
+		if to != nil {
+			recipients = to
+		}
+		if err == nil {
+			err = s.Send(envelopeFrom(msg, from), recipients, msg)
+		}
+
+		if err != nil {
+			return &sendError{index: i, cause: err}
+		}
+	}
+
+	return nil
+}
+
+// envelopeFrom is the envelope sender of msg. The login replaces from, e.g. the address of a From
+// header with another display name or address, unless msg has a Return-Path or Sender header.
+func (s *smtpSender) envelopeFrom(msg io.WriterTo, from string) string {
+	m, ok := msg.(*mail.Message)
+	if ok && s.login != "" && len(m.GetHeader("Return-Path")) == 0 && len(m.GetHeader("Sender")) == 0 {
+		return s.login
+	}
+
+	return envelopeFrom(msg, from)
+}
+
+func (s *smtpSender) Send(from string, to []string, msg io.WriterTo) (err error) {
+	from = s.envelopeFrom(msg, from)
+
+	if s.dkim != nil {
+		if msg, err = signDKIM(msg, s.dkim); err != nil {
+			return
+		}
+	}
+
+	if s.timeout > 0 {
+		s.conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	if err = s.client.Mail(from); err != nil {
+		return
+	}
+	delivered := false
+	defer func() {
+		// abort the transaction so the connection can be used for further messages
+		if err != nil && !delivered {
+			s.client.Reset()
+		}
+	}()
+
+	// rejected recipients are collected, so the message is delivered to the accepted ones
+	rejected := &SendErrors{failed: map[string]error{}}
+	for _, addr := range to {
+		if rcptErr := s.client.Rcpt(addr); rcptErr != nil {
+			var protoErr *textproto.Error
+			if !errors.As(rcptErr, &protoErr) {
+				return rcptErr
+			}
+			rejected.failed[addr] = categorize(rcptErr, ErrRecipientRejected)
+		}
+	}
+
+	if len(rejected.failed) == len(to) {
+		return rejected
+	}
+
+	w, err := s.client.Data()
+	if err != nil {
+		return
+	}
+
+	if _, err = msg.WriteTo(w); err != nil {
+		// drop the connection instead of ending the data, so the incomplete message isn't delivered
+		s.rawConn.Close()
+		return
+	}
+
+	if err = w.Close(); err != nil {
+		return
+	}
+	delivered = true
+
+	if len(rejected.failed) > 0 {
+		rejected.delivered = true
+		return rejected
+	}
+
+	return nil
+}
+
+func (s *smtpSender) Close() error {
+	if s.timeout > 0 {
+		s.conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	if err := s.client.Quit(); err != nil {
+		s.rawConn.Close()
+		return err
+	}
+
+	return nil
+}
+
+// sendError is the error of the message at index when sending several messages, like mail.SendError
+// but the cause can be inspected with errors.Is and errors.As
+type sendError struct {
+	index int
+	cause error
+}
+
+func (e *sendError) Error() string {
+	return fmt.Sprintf("couldn't send message %d: %v", e.index+1, e.cause)
+}
+
+func (e *sendError) Unwrap() error {
+	return e.cause
+}
+
+// isTemporary reports whether err is a temporary smtp or connection error, which may succeed when retried
+func isTemporary(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var rejected *SendErrors
+	if errors.As(err, &rejected) {
+		// retrying a delivered message would deliver it twice to the accepted recipients
+		if rejected.delivered {
+			return false
+		}
+
+		for _, err := range rejected.failed {
+			if !isTemporary(err) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+
+	return isConnectionError(err)
+}
+
+// loginAuth implements the LOGIN authentication mechanism like the one of mail.v2
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		advertised := false
+		for _, mechanism := range server.Auth {
+			if mechanism == "LOGIN" {
+				advertised = true
+				break
+			}
+		}
+
+		if !advertised {
+			return "", nil, errors.New("unencrypted connection")
+		}
+	}
+
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch {
+	case bytes.Equal(fromServer, []byte("Username:")):
+		return []byte(a.username), nil
+	case bytes.Equal(fromServer, []byte("Password:")):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+	}
+}
+
+// xoauth2Auth implements the XOAUTH2 authentication mechanism of Gmail and Office 365
+type xoauth2Auth struct {
+	username    string
+	tokenSource func(ctx context.Context) (string, error)
+	ctx         context.Context
+}
+
+// withContext returns a copy of a which gets its token with ctx
+func (a *xoauth2Auth) withContext(ctx context.Context) *xoauth2Auth {
+	b := *a
+	b.ctx = ctx
+	return &b
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	token, err := a.tokenSource(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("couldn't get access token: %v", err)
+	}
+
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + token + "\x01\x01"), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// the server sends an error as challenge, the empty response completes the exchange with the error
+		return []byte{}, nil
+	}
+
+	return nil, nil
+}
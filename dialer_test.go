@@ -0,0 +1,139 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	stdmail "net/mail"
+	"strings"
+	"sync"
+	"testing"
+
+	gomail "gopkg.in/mail.v2"
+
+	"github.com/f9a/mail"
+)
+
+// fakeDialer captures the messages and their envelope recipients instead of sending them
+type fakeDialer struct {
+	mu       sync.Mutex
+	messages []*gomail.Message
+	to       [][]string
+	err      error
+}
+
+func (d *fakeDialer) Dial() (gomail.SendCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return d, nil
+}
+
+func (d *fakeDialer) Send(from string, to []string, msg io.WriterTo) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.messages = append(d.messages, msg.(*gomail.Message))
+	d.to = append(d.to, to)
+	return nil
+}
+
+func (d *fakeDialer) Close() error {
+	return nil
+}
+
+func TestFakeDialer(t *testing.T) {
+	tx, err := mail.Dial(mail.TxConfig{User: "test@example.de", Password: "xxx", Host: "smtp.example.de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakeDialer{}
+	mail.SetDialer(tx, d)
+
+	err = tx.Send("Acme <test@example.de>", mail.To{"ava@example.de"}, mail.Message{
+		Topic:       "topic",
+		Body:        "body",
+		ContentType: "text/plain",
+		Attachments: []mail.Attachment{{Name: "logo", Kind: "image/png", Content: pngContent}},
+	}, mail.Cc("ben@example.de"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.messages) != 1 {
+		t.Fatalf("expected one message, got %v", len(d.messages))
+	}
+
+	m := d.messages[0]
+	if got := m.GetHeader("Cc"); len(got) != 1 || got[0] != "ben@example.de" {
+		t.Errorf("unexpected Cc header %v", got)
+	}
+
+	var buf bytes.Buffer
+	if _, err = m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := stdmail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := msg.Header.Get("Subject"); got != "topic" {
+		t.Errorf("unexpected subject %q", got)
+	}
+
+	if !strings.HasPrefix(msg.Header.Get("Content-Type"), "multipart/mixed") {
+		t.Errorf("expected message with attachment, got content type %q", msg.Header.Get("Content-Type"))
+	}
+
+	errs := tx.SendBatch(context.Background(), "test@example.de", []mail.BatchItem{
+		{To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "one"}},
+		{To: mail.To{"ben@example.de"}, Message: mail.Message{Topic: "two"}},
+	})
+	if errs[0] != nil || errs[1] != nil || len(d.messages) != 3 {
+		t.Errorf("expected batch to be sent with the fake dialer, got %v and %d messages", errs, len(d.messages))
+	}
+
+	d.err = errors.New("connection refused")
+	if err = tx.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}); !errors.Is(err, d.err) {
+		t.Errorf("expected error of the dialer, got: %v", err)
+	}
+}
+
+func TestFakeDialerSendRoles(t *testing.T) {
+	tx, err := mail.Dial(mail.TxConfig{User: "test@example.de", Password: "xxx", Host: "smtp.example.de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakeDialer{}
+	mail.SetDialer(tx, d)
+
+	results := tx.SendRoles(context.Background(), "test@example.de", mail.MustTemplate("topic", "body"), []mail.RoleRecipient{
+		{Address: "ava@example.de", Role: mail.RoleTo},
+		{Address: "ben@example.de", Role: mail.RoleCc},
+		{Address: "audit@example.de", Role: mail.RoleBcc},
+	})
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+
+	if len(d.to) != 3 {
+		t.Fatalf("expected 3 copies, got %v", len(d.to))
+	}
+
+	for i, want := range []string{"ava@example.de", "ben@example.de", "audit@example.de"} {
+		if len(d.to[i]) != 1 || d.to[i][0] != want {
+			t.Errorf("expected copy %d only delivered to %v, got %v", i+1, want, d.to[i])
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"gopkg.in/mail.v2"
+)
+
+// WithDKIM signs all further messages with a DKIM-Signature of domain, the public key must be
+// published as TXT record of <selector>._domainkey.<domain>. Keys can be rsa or ed25519 keys,
+// a nil key disables signing. It's safe for concurrent use.
+func (tx *Tx) WithDKIM(domain, selector string, privateKey crypto.Signer) error {
+	if privateKey == nil {
+		tx.dkim.Store((*dkim.SignOptions)(nil))
+		return nil
+	}
+
+	switch privateKey.Public().(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unsupported dkim key type %T, use an rsa or ed25519 key", privateKey.Public())
+	}
+
+	if domain == "" || selector == "" {
+		return errors.New("dkim needs a domain and a selector")
+	}
+
+	tx.dkim.Store(&dkim.SignOptions{
+		Domain:                 domain,
+		Selector:               selector,
+		Signer:                 privateKey,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+	})
+
+	return nil
+}
+
+// dkimOptions returns the options set with WithDKIM or nil
+func (tx *Tx) dkimOptions() *dkim.SignOptions {
+	opts, _ := tx.dkim.Load().(*dkim.SignOptions)
+	return opts
+}
+
+// signDKIM renders msg and prepends the DKIM-Signature header
+func signDKIM(msg io.WriterTo, opts *dkim.SignOptions) (io.WriterTo, error) {
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	if m, ok := msg.(*mail.Message); ok && len(m.GetHeader("Return-Path")) > 0 {
+		// the receiving server replaces the Return-Path, so it must not be signed
+		keys, err := headerKeys(buf.Bytes(), "Return-Path")
+		if err != nil {
+			return nil, err
+		}
+
+		withKeys := *opts
+		withKeys.HeaderKeys = keys
+		opts = &withKeys
+	}
+
+	var signed bytes.Buffer
+	if err := dkim.Sign(&signed, &buf, opts); err != nil {
+		return nil, fmt.Errorf("couldn't sign message with dkim: %v", err)
+	}
+
+	return &signed, nil
+}
+
+// headerKeys returns the sorted keys of the headers of raw, except the excluded ones
+func headerKeys(raw []byte, exclude ...string) (keys []string, err error) {
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw))).ReadMIMEHeader()
+	if err != nil {
+		return
+	}
+
+	for _, key := range exclude {
+		header.Del(key)
+	}
+
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return
+}
@@ -0,0 +1,128 @@
+package mail_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+
+	"github.com/f9a/mail"
+)
+
+func TestWithDKIM(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.WithDKIM("example.de", "mail", key); err != nil {
+		t.Fatal(err)
+	}
+
+	message := mail.Message{Topic: "topic", Body: "Hi\nsigned", ContentType: "text/plain"}
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	data := server.Envelopes()[0].Data
+	if !strings.HasPrefix(data, "DKIM-Signature: ") {
+		t.Fatalf("expected DKIM-Signature header:\n%s", data)
+	}
+
+	verifications, err := dkim.VerifyWithOptions(strings.NewReader(strings.ReplaceAll(data, "\n", "\r\n")), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != "mail._domainkey.example.de" {
+				t.Errorf("unexpected dkim lookup of %v", domain)
+			}
+			return []string{"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(verifications) != 1 || verifications[0].Err != nil || verifications[0].Domain != "example.de" {
+		t.Fatalf("expected valid signature of example.de, got: %+v", verifications[0])
+	}
+
+	if err = m.WithDKIM("example.de", "mail", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(server.Envelopes()[1].Data, "DKIM-Signature") {
+		t.Error("expected no signature after disabling dkim")
+	}
+
+	if err = m.WithDKIM("", "mail", key); err == nil {
+		t.Error("expected error for missing domain")
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.WithDKIM("example.de", "mail", rsaKey); err != nil {
+		t.Errorf("expected rsa key to be supported, got: %v", err)
+	}
+}
+
+func TestWithDKIMReturnPath(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.WithDKIM("example.de", "mail", key); err != nil {
+		t.Fatal(err)
+	}
+
+	message := mail.Message{Topic: "topic", Body: "signed", ContentType: "text/plain"}
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message, mail.ReturnPath("bounces@example.de")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the receiving server replaces the Return-Path with the envelope sender
+	data := strings.Replace(server.Envelopes()[0].Data, "Return-Path: <bounces@example.de>", "Return-Path: <relay@example.com>", 1)
+
+	verifications, err := dkim.VerifyWithOptions(strings.NewReader(strings.ReplaceAll(data, "\n", "\r\n")), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return []string{"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(verifications) != 1 || verifications[0].Err != nil {
+		t.Fatalf("expected valid signature with replaced Return-Path, got: %+v", verifications[0])
+	}
+
+	for _, key := range verifications[0].HeaderKeys {
+		if strings.EqualFold(key, "Return-Path") {
+			t.Error("expected Return-Path not to be signed")
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Categories of send errors, they can be checked with errors.Is. An error can be in several
+// categories, e.g. a temporarily rejected recipient is ErrRecipientRejected and ErrTemporary.
+var (
+	// ErrAuth is an error of the authentication, e.g. invalid credentials
+	ErrAuth = errors.New("smtp authentication failed")
+	// ErrConnection is an error of the connection to the smtp server, e.g. it's unreachable
+	ErrConnection = errors.New("smtp connection failed")
+	// ErrRecipientRejected is the error of a recipient the smtp server didn't accept
+	ErrRecipientRejected = errors.New("smtp recipient rejected")
+	// ErrTemporary is a temporary 4xx reply of the smtp server, the send may succeed when retried
+	ErrTemporary = errors.New("smtp temporary failure")
+)
+
+// categorizedError is err in categories, it unwraps to both
+type categorizedError struct {
+	err        error
+	categories []error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() []error {
+	return append(append([]error{}, e.categories...), e.err)
+}
+
+// categorize wraps err with stage, e.g. ErrAuth, and the categories of its smtp reply or connection error.
+// Errors of ctx, SendErrors and already categorized errors are returned as they are.
+func categorize(err error, stage error) error {
+	if err == nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var categorized *categorizedError
+	var rejected *SendErrors
+	if errors.As(err, &categorized) || errors.As(err, &rejected) {
+		return err
+	}
+
+	var categories []error
+	if stage != nil {
+		categories = append(categories, stage)
+	}
+
+	var protoErr *textproto.Error
+	switch {
+	case errors.As(err, &protoErr):
+		if protoErr.Code >= 400 && protoErr.Code < 500 {
+			categories = append(categories, ErrTemporary)
+		}
+	case isConnectionError(err):
+		categories = append(categories, ErrConnection)
+	}
+
+	if len(categories) == 0 {
+		return err
+	}
+
+	return &categorizedError{err: err, categories: categories}
+}
+
+// isConnectionError reports whether err is a network error or the connection was closed
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// SendErrors are the errors of the recipients the smtp server rejected.
+// When Delivered reports true the message was delivered to all other recipients,
+// so only the failed ones need to be retried.
+type SendErrors struct {
+	failed    map[string]error
+	delivered bool
+}
+
+// Failed returns the errors keyed by the rejected addresses
+func (e *SendErrors) Failed() map[string]error {
+	failed := make(map[string]error, len(e.failed))
+	for addr, err := range e.failed {
+		failed[addr] = err
+	}
+
+	return failed
+}
+
+// Delivered reports whether the message was delivered to the recipients which weren't rejected
+func (e *SendErrors) Delivered() bool {
+	return e.delivered
+}
+
+// addresses returns the sorted rejected addresses
+func (e *SendErrors) addresses() []string {
+	addrs := make([]string, 0, len(e.failed))
+	for addr := range e.failed {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	return addrs
+}
+
+func (e *SendErrors) Error() string {
+	msgs := make([]string, 0, len(e.failed))
+	for _, addr := range e.addresses() {
+		msgs = append(msgs, fmt.Sprintf("%v: %v", addr, e.failed[addr]))
+	}
+
+	return fmt.Sprintf("%d recipients rejected: %v", len(e.failed), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the rejected addresses, so they can be inspected with errors.Is and errors.As
+func (e *SendErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e.failed))
+	for _, addr := range e.addresses() {
+		errs = append(errs, e.failed[addr])
+	}
+
+	return errs
+}
@@ -0,0 +1,7 @@
+package mail
+
+// SetDialer replaces the dialer of tx, so tests can capture the built messages.
+// UpdateTxConfig replaces it with the dialer of the config again.
+func SetDialer(tx *Tx, d dialer) {
+	tx.setDialer(d)
+}
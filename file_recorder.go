@@ -0,0 +1,167 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ Recorder = &FileRecorder{}
+
+// FileRecorder records mails in Dir, it is safe for concurrent use.
+//
+// Every mail is written as <timestamp>-<n>.json, which is used by Seen, and
+// as <timestamp>-<n>.eml which can be opened with any mail client.
+type FileRecorder struct {
+	// Dir the mails are written to, it's created when it doesn't exist
+	Dir string
+
+	mu  sync.Mutex
+	seq uint64
+	cfg atomic.Value
+}
+
+// NewFileRecorder creates a recorder writing to dir
+func NewFileRecorder(dir string) *FileRecorder {
+	return &FileRecorder{Dir: dir}
+}
+
+func (r *FileRecorder) Send(from string, to To, message Message, options ...SendOption) (err error) {
+	_, err = r.SendContext(context.Background(), from, to, message, options...)
+	return
+}
+
+func (r *FileRecorder) SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	if r.Dir == "" {
+		err = errors.New("file recorder has no dir")
+		return
+	}
+
+	m, err := newMessage(from, to, message, r.TxConfig().messageIDDomain(from), options)
+	if err != nil {
+		return
+	}
+	messageID = m.GetHeader("Message-Id")[0]
+
+	data, err := json.MarshalIndent(Mail{
+		From:      from,
+		To:        to,
+		Message:   message,
+		MessageID: messageID,
+	}, "", "  ")
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err = os.MkdirAll(r.Dir, 0o755); err != nil {
+		return
+	}
+
+	r.seq++
+	name := filepath.Join(r.Dir, fmt.Sprintf("%v-%06d", time.Now().UTC().Format("20060102T150405.000000000"), r.seq))
+
+	eml, err := os.Create(name + ".eml")
+	if err != nil {
+		return
+	}
+	if _, err = m.WriteTo(eml); err != nil {
+		eml.Close()
+		return
+	}
+	if err = eml.Close(); err != nil {
+		return
+	}
+
+	if err = os.WriteFile(name+".json", data, 0o644); err != nil {
+		return
+	}
+
+	return messageID, nil
+}
+
+// Mails reads all recorded mails in the order they were sent
+func (r *FileRecorder) Mails() (mails []Mail, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries, err := os.ReadDir(r.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(r.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := Mail{}
+		if err = json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("couldn't decode recorded mail %q: %v", name, err)
+		}
+
+		mails = append(mails, m)
+	}
+
+	return
+}
+
+// Seen reports whether any mail recorded in Dir matches m
+func (r *FileRecorder) Seen(m Mail) (ok bool, err error) {
+	return r.seen(m, false)
+}
+
+// SeenLoose is like Seen but the recipients of m can be in any order
+func (r *FileRecorder) SeenLoose(m Mail) (ok bool, err error) {
+	return r.seen(m, true)
+}
+
+func (r *FileRecorder) seen(m Mail, anyOrder bool) (ok bool, err error) {
+	mails, err := r.Mails()
+	if err != nil {
+		return
+	}
+
+	for _, recorded := range mails {
+		if sameMail(recorded, m, anyOrder) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *FileRecorder) UpdateTxConfig(cfg TxConfig) {
+	r.cfg.Store(cfg)
+}
+
+func (r *FileRecorder) TxConfig() TxConfig {
+	cfg, _ := r.cfg.Load().(TxConfig)
+	return cfg
+}
@@ -0,0 +1,77 @@
+package mail_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestFileRecorder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mails")
+	r := mail.NewFileRecorder(dir)
+
+	first := mail.Message{Topic: "first", Body: "Hi", ContentType: "text/plain"}
+	second := mail.Message{
+		Topic:       "second",
+		Body:        "<b>Hi</b>",
+		ContentType: "text/html",
+		Attachments: []mail.Attachment{{Name: "image", Kind: "image/png", Content: pngContent}},
+	}
+
+	if err := r.Send("test@example.de", mail.To{"ava@example.de"}, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Send("test@example.de", mail.To{"ben@example.de"}, second); err != nil {
+		t.Fatal(err)
+	}
+
+	mails, err := r.Mails()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mails) != 2 || mails[0].Message.Topic != "first" || mails[1].Message.Topic != "second" {
+		t.Fatalf("unexpected recorded mails: %+v", mails)
+	}
+
+	ok, err := r.Seen(mail.Mail{From: "test@example.de", To: mail.To{"ben@example.de"}, Message: second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("expected mail with attachment to be seen")
+	}
+
+	ok, _ = r.Seen(mail.Mail{From: "test@example.de", To: mail.To{"ava@example.de"}, Message: second})
+	if ok {
+		t.Error("expected mail not to be seen")
+	}
+
+	loose := mail.NewFileRecorder(filepath.Join(t.TempDir(), "loose"))
+	if err = loose.Send("test@example.de", mail.To{"ava@example.de", "ben@example.de"}, first); err != nil {
+		t.Fatal(err)
+	}
+	reordered := mail.Mail{From: "test@example.de", To: mail.To{"ben@example.de", "ava@example.de"}, Message: first}
+	if ok, _ = loose.Seen(reordered); ok {
+		t.Error("expected Seen to compare the order of the recipients")
+	}
+	if ok, _ = loose.SeenLoose(reordered); !ok {
+		t.Error("expected SeenLoose to ignore the order of the recipients")
+	}
+
+	emls, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(emls) != 2 {
+		t.Fatalf("expected 2 eml files, got: %v", emls)
+	}
+
+	eml, err := os.ReadFile(emls[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(eml), "Subject: second") {
+		t.Errorf("unexpected eml:\n%s", eml)
+	}
+}
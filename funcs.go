@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// title upper cases the first letter of every word, e.g. {{title "ava smith"}} renders "Ava Smith"
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) {
+			return unicode.ToTitle(r)
+		}
+
+		return r
+	}, s)
+}
+
+// truncate shortens s to n characters and appends "…" when s was cut,
+// e.g. {{.Quote | truncate 5}} renders "Hello…" for "Hello World"
+func truncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n]) + "…"
+}
+
+// empty reports whether v is nil, a zero value or an empty collection
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
+
+// defaultValue returns fallback when value is empty, e.g. {{.Name | default "customer"}}
+func defaultValue(fallback, value interface{}) interface{} {
+	if empty(value) {
+		return fallback
+	}
+
+	return value
+}
+
+// join joins the elements of a slice or array, e.g. {{.Tags | join ", "}}
+func join(sep string, list interface{}) (string, error) {
+	if s, ok := list.([]string); ok {
+		return strings.Join(s, sep), nil
+	}
+
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join expects a list, got %T", list)
+	}
+
+	elems := make([]string, rv.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+
+	return strings.Join(elems, sep), nil
+}
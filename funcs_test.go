@@ -0,0 +1,74 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestTemplateStringFuncs(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{body: `{{upper .Name}}`, want: "ÄVA"},
+		{body: `{{lower "AVA"}}`, want: "ava"},
+		{body: `{{title "ava van smith"}}`, want: "Ava Van Smith"},
+		{body: `{{trim "  Hi \n"}}`, want: "Hi"},
+		{body: `{{.Quote | truncate 5}}`, want: "Grüße…"},
+		{body: `{{.Quote | truncate 20}}`, want: "Grüße aus Köln"},
+		{body: `{{"日本語テキスト" | truncate 3}}`, want: "日本語…"},
+		{body: `{{.Missing | default "customer"}}`, want: "customer"},
+		{body: `{{.Name | default "customer"}}`, want: "äva"},
+		{body: `{{.Tags | join ", "}}`, want: "a, b"},
+		{body: `{{.Numbers | join "-"}}`, want: "1-2-3"},
+	}
+
+	data := map[string]interface{}{
+		"Name":    "äva",
+		"Quote":   "Grüße aus Köln",
+		"Missing": "",
+		"Tags":    []string{"a", "b"},
+		"Numbers": []int{1, 2, 3},
+	}
+
+	for _, test := range tests {
+		tpl, err := mail.NewTemplate("", test.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := tpl.Execute(data)
+		if err != nil {
+			t.Fatalf("%v: %v", test.body, err)
+		}
+
+		if msg.Body != test.want {
+			t.Errorf("%v: expected %q, got %q", test.body, test.want, msg.Body)
+		}
+	}
+}
+
+func TestTemplateFuncsOverrideDefaults(t *testing.T) {
+	tpl, err := mail.NewTemplate("", `{{upper "ava"}}`, mail.TemplateFuncs(map[string]interface{}{
+		"upper": func(s string) string { return "custom " + s },
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Body != "custom ava" {
+		t.Errorf("expected overridden func, got %q", msg.Body)
+	}
+
+	tpl, _ = mail.NewTemplate("", `{{join ", " 5}}`)
+	if _, err = tpl.Execute(nil); err == nil || !strings.Contains(err.Error(), "expects a list") {
+		t.Errorf("expected error for join of non list, got: %v", err)
+	}
+}
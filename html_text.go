@@ -0,0 +1,172 @@
+package mail
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlToText converts a html body to readable plain text.
+// Whitespace is collapsed, links become "text (url)" and list items are prefixed with "- " or their number.
+func htmlToText(s string) string {
+	var (
+		b      strings.Builder
+		skip   int
+		lists  []int // item counters of the open lists, -1 for unordered lists
+		links  []string
+		linkAt []int
+	)
+
+	newline := func(n int) {
+		text := b.String()
+		trailing := len(text) - len(strings.TrimRight(text, "\n"))
+		if len(text) == trailing {
+			return
+		}
+
+		for ; trailing < n; trailing++ {
+			b.WriteByte('\n')
+		}
+	}
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+
+			text := collapseSpace(tok.Data)
+			if current := b.String(); current == "" || strings.HasSuffix(current, "\n") || strings.HasSuffix(current, " ") {
+				text = strings.TrimLeft(text, " ")
+			}
+			b.WriteString(text)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch tok.DataAtom {
+			case atom.Script, atom.Style, atom.Head, atom.Title:
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case atom.Br:
+				trimTrailingSpace(&b)
+				b.WriteByte('\n')
+			case atom.P, atom.Div, atom.Table, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Blockquote:
+				trimTrailingSpace(&b)
+				newline(2)
+			case atom.Tr, atom.Hr:
+				trimTrailingSpace(&b)
+				newline(1)
+			case atom.Ul:
+				trimTrailingSpace(&b)
+				newline(1)
+				lists = append(lists, -1)
+			case atom.Ol:
+				trimTrailingSpace(&b)
+				newline(1)
+				lists = append(lists, 0)
+			case atom.Li:
+				trimTrailingSpace(&b)
+				newline(1)
+				if len(lists) > 0 && lists[len(lists)-1] >= 0 {
+					lists[len(lists)-1]++
+					b.WriteString(strconv.Itoa(lists[len(lists)-1]) + ". ")
+				} else {
+					b.WriteString("- ")
+				}
+			case atom.A:
+				href := ""
+				for _, attr := range tok.Attr {
+					if attr.Key == "href" {
+						href = strings.TrimSpace(attr.Val)
+					}
+				}
+				links = append(links, href)
+				linkAt = append(linkAt, b.Len())
+			}
+		case html.EndTagToken:
+			switch tok.DataAtom {
+			case atom.Script, atom.Style, atom.Head, atom.Title:
+				if skip > 0 {
+					skip--
+				}
+			case atom.P, atom.Div, atom.Table, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Blockquote:
+				trimTrailingSpace(&b)
+				newline(2)
+			case atom.Ul, atom.Ol:
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+				trimTrailingSpace(&b)
+				newline(2)
+			case atom.A:
+				if len(links) == 0 {
+					continue
+				}
+
+				href, at := links[len(links)-1], linkAt[len(linkAt)-1]
+				links, linkAt = links[:len(links)-1], linkAt[:len(linkAt)-1]
+
+				text := strings.TrimSpace(b.String()[at:])
+				if href == "" || strings.HasPrefix(href, "#") || href == text || strings.TrimPrefix(href, "mailto:") == text {
+					continue
+				}
+
+				trailing := strings.HasSuffix(b.String(), " ")
+				trimTrailingSpace(&b)
+				b.WriteString(" (" + href + ")")
+				if trailing {
+					b.WriteByte(' ')
+				}
+			}
+		}
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// collapseSpace replaces every run of whitespace with a single space
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+
+	if space {
+		b.WriteByte(' ')
+	}
+
+	return b.String()
+}
+
+func trimTrailingSpace(b *strings.Builder) {
+	s := b.String()
+	if trimmed := strings.TrimRight(s, " "); len(trimmed) != len(s) {
+		b.Reset()
+		b.WriteString(trimmed)
+	}
+}
@@ -0,0 +1,85 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestAutoTextAlternative(t *testing.T) {
+	body := `<html><head><title>Welcome</title><style>p { color: red; }</style></head>
+<body>
+	<h1>Hello   {{.Name}}</h1>
+	<p>Thanks for
+	signing up, see <a href="https://example.de/docs">the docs</a> or
+	<a href="https://example.de">https://example.de</a>.</p>
+	<ul>
+		<li>first</li>
+		<li><b>second</b> item</li>
+	</ul>
+	<ol><li>one</li><li>two</li></ol>
+	<p>Bye<br>Team</p>
+</body></html>`
+
+	tpl, err := mail.NewTemplate("topic", body, mail.ContentType("text/html"), mail.AutoTextAlternative())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(testData{Name: "Ava"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `Hello Ava
+
+Thanks for signing up, see the docs (https://example.de/docs) or https://example.de.
+
+- first
+- second item
+
+1. one
+2. two
+
+Bye
+Team`
+	if msg.Body != want {
+		t.Errorf("unexpected text body:\n%s\nwant:\n%s", msg.Body, want)
+	}
+
+	if msg.ContentType != "text/plain" {
+		t.Errorf("expected text/plain body, got %v", msg.ContentType)
+	}
+
+	if len(msg.Alternatives) != 1 || msg.Alternatives[0].ContentType != "text/html" {
+		t.Fatalf("expected html alternative, got %+v", msg.Alternatives)
+	}
+
+	tpl, err = mail.NewTemplate("topic", "Hi {{.Name}}", mail.AutoTextAlternative())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = tpl.Execute(testData{Name: "Ava"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Body != "Hi Ava" || len(msg.Alternatives) != 0 {
+		t.Errorf("expected plain text template to be unchanged, got %+v", msg)
+	}
+
+	tpl, err = mail.NewMultipartTemplate("topic", "text", "<p>html</p>", mail.AutoTextAlternative())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Body != "text" || len(msg.Alternatives) != 1 {
+		t.Errorf("expected explicit text body to be kept, got %+v", msg)
+	}
+}
@@ -0,0 +1,160 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var _ ConfigurableSender = &HTTPSender{}
+
+// HTTPPayload is the JSON body posted by HTTPSender. The options are resolved like
+// for Tx.Send: with AsCc all but the first recipient are in Cc, Date is nil to use
+// the time of sending and Sender is empty when it's the from address.
+type HTTPPayload struct {
+	From       string              `json:"from"`
+	To         To                  `json:"to"`
+	Cc         []string            `json:"cc,omitempty"`
+	Bcc        []string            `json:"bcc,omitempty"`
+	ReplyTo    []string            `json:"replyTo,omitempty"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Date       *time.Time          `json:"date,omitempty"`
+	Sender     string              `json:"sender,omitempty"`
+	ReturnPath string              `json:"returnPath,omitempty"`
+	MessageID  string              `json:"messageId"`
+	Message    Message             `json:"message"`
+}
+
+// HTTPSender sends mails by posting them as HTTPPayload to an http endpoint,
+// e.g. for platforms where outbound smtp is blocked.
+//
+// User and Password of the TxConfig are used for basic auth, Timeout for the request timeout.
+type HTTPSender struct {
+	// Endpoint is the url the mails are posted to
+	Endpoint string
+	// Client is used to post the mails, defaults to http.DefaultClient
+	Client *http.Client
+
+	cfg atomic.Value
+}
+
+// NewHTTPSender creates a sender posting mails to endpoint
+func NewHTTPSender(endpoint string, cfg TxConfig) *HTTPSender {
+	s := &HTTPSender{Endpoint: endpoint}
+	s.UpdateTxConfig(cfg)
+
+	return s
+}
+
+// UpdateTxConfig is safe for concurrent use
+func (s *HTTPSender) UpdateTxConfig(cfg TxConfig) {
+	s.cfg.Store(cfg)
+}
+
+// Send sends message
+func (s *HTTPSender) Send(from string, to To, message Message, options ...SendOption) (err error) {
+	_, err = s.SendContext(context.Background(), from, to, message, options...)
+	return
+}
+
+// SendContext posts the message and returns its Message-ID
+func (s *HTTPSender) SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error) {
+	if s.Endpoint == "" {
+		err = errors.New("http sender has no endpoint")
+		return
+	}
+
+	cfg, _ := s.cfg.Load().(TxConfig)
+
+	// build the message to validate it the same way as Tx.Send
+	m, err := newMessage(from, to, message, cfg.messageIDDomain(from), options)
+	if err != nil {
+		return
+	}
+	messageID = m.GetHeader("Message-Id")[0]
+
+	// streamed attachments are read, because the payload carries the content
+	attachments := make([]Attachment, len(message.Attachments))
+	for i, a := range message.Attachments {
+		a.Content, err = a.content()
+		if err != nil {
+			err = fmt.Errorf("couldn't read attachment %v: %v", a.Name, err)
+			return
+		}
+		a.Open = nil
+		attachments[i] = a
+	}
+	message.Attachments = attachments
+
+	opts := sendOptions{}
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	if opts.normalize {
+		to = opts.normalizeRecipients(to)
+	}
+
+	payload := HTTPPayload{
+		From:       from,
+		Bcc:        opts.bcc,
+		ReplyTo:    opts.replyTo,
+		Headers:    opts.headers,
+		ReturnPath: opts.returnPath,
+		MessageID:  messageID,
+		Message:    message,
+	}
+	payload.To, payload.Cc = opts.headerRecipients(to)
+	if !opts.date.IsZero() {
+		payload.Date = &opts.date
+	}
+	if opts.sender != "" && !strings.EqualFold(bareAddress(opts.sender), bareAddress(from)) {
+		payload.Sender = opts.sender
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		err = fmt.Errorf("couldn't encode mail: %v", err)
+		return
+	}
+
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.User != "" {
+		req.SetBasicAuth(cfg.User, cfg.Password)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("http endpoint responded with %v: %s", resp.Status, bytes.TrimSpace(msg))
+		return
+	}
+
+	return
+}
@@ -0,0 +1,92 @@
+package mail_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f9a/mail"
+)
+
+func TestHTTPSender(t *testing.T) {
+	var got mail.HTTPPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "api" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	var sender mail.ConfigurableSender = mail.NewHTTPSender(server.URL, mail.TxConfig{User: "api", Password: "secret"})
+
+	message := mail.Message{Topic: "topic", Body: "Hi", ContentType: "text/plain"}
+	err := sender.Send("test@example.de", mail.To{"ava@example.de"}, message, mail.Cc("ben@example.de"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.From != "test@example.de" || got.To[0] != "ava@example.de" || got.Cc[0] != "ben@example.de" {
+		t.Errorf("unexpected payload: %+v", got)
+	}
+
+	if got.Message.Topic != "topic" || got.Message.Body != "Hi" || got.MessageID == "" {
+		t.Errorf("unexpected message in payload: %+v", got)
+	}
+
+	sender.UpdateTxConfig(mail.TxConfig{User: "api", Password: "wrong"})
+	err = sender.Send("test@example.de", mail.To{"ava@example.de"}, message)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected unauthorized error, got: %v", err)
+	}
+}
+
+func TestHTTPSenderOptions(t *testing.T) {
+	var got mail.HTTPPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	date := time.Date(2024, time.March, 4, 9, 30, 0, 0, time.UTC)
+	sender := mail.NewHTTPSender(server.URL, mail.TxConfig{})
+	message := mail.Message{Topic: "topic", Body: "Hi", ContentType: "text/plain"}
+	err := sender.Send("test@example.de", mail.To{"ava@example.de", "ben@example.de"}, message,
+		mail.AsCc(),
+		mail.Cc("carl@example.de"),
+		mail.Date(date),
+		mail.WithSender("office@example.de"),
+		mail.ReturnPath("bounces@example.de"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(got.To, ",") != "ava@example.de" || strings.Join(got.Cc, ",") != "ben@example.de,carl@example.de" {
+		t.Errorf("expected all but the first recipient in cc, got to %v and cc %v", got.To, got.Cc)
+	}
+
+	if got.Date == nil || !got.Date.Equal(date) {
+		t.Errorf("expected date %v, got %v", date, got.Date)
+	}
+
+	if got.Sender != "office@example.de" || got.ReturnPath != "bounces@example.de" {
+		t.Errorf("unexpected sender %q and return path %q", got.Sender, got.ReturnPath)
+	}
+}
@@ -0,0 +1,276 @@
+package mail
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLocale is used by timef for formats without a locale suffix
+const defaultLocale = "de"
+
+type locale struct {
+	days      map[time.Weekday]string
+	months    map[time.Month]string
+	dateShort string
+	timeShort string
+	longDate  func(l locale, t time.Time) string
+	abbrev    func(l locale, t time.Time) string
+
+	decimalSep   string
+	thousandsSep string
+	// symbolFirst puts the currency symbol in front of the amount
+	symbolFirst bool
+}
+
+// abbreviate returns the first n runes of s
+func abbreviate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+
+	return string(r[:n])
+}
+
+var locales = map[string]locale{
+	"de": {
+		days: map[time.Weekday]string{
+			time.Monday:    "Montag",
+			time.Tuesday:   "Dienstag",
+			time.Wednesday: "Mittwoch",
+			time.Thursday:  "Donnerstag",
+			time.Friday:    "Freitag",
+			time.Saturday:  "Samstag",
+			time.Sunday:    "Sonntag",
+		},
+		months: map[time.Month]string{
+			time.January:   "Januar",
+			time.February:  "Februar",
+			time.March:     "März",
+			time.April:     "April",
+			time.May:       "Mai",
+			time.June:      "Juni",
+			time.July:      "Juli",
+			time.August:    "August",
+			time.September: "September",
+			time.October:   "Oktober",
+			time.November:  "November",
+			time.December:  "Dezember",
+		},
+		dateShort: "02.01.2006",
+		timeShort: "02.01.2006 15:04:05",
+		longDate: func(l locale, t time.Time) string {
+			return fmt.Sprintf("%s, %02d. %s %d", l.days[t.Weekday()], t.Day(), l.months[t.Month()], t.Year())
+		},
+		abbrev: func(l locale, t time.Time) string {
+			return fmt.Sprintf("%s, %02d. %s %d", abbreviate(l.days[t.Weekday()], 2), t.Day(), l.months[t.Month()], t.Year())
+		},
+		decimalSep:   ",",
+		thousandsSep: ".",
+	},
+	"en": {
+		days: map[time.Weekday]string{
+			time.Monday:    "Monday",
+			time.Tuesday:   "Tuesday",
+			time.Wednesday: "Wednesday",
+			time.Thursday:  "Thursday",
+			time.Friday:    "Friday",
+			time.Saturday:  "Saturday",
+			time.Sunday:    "Sunday",
+		},
+		months: map[time.Month]string{
+			time.January:   "January",
+			time.February:  "February",
+			time.March:     "March",
+			time.April:     "April",
+			time.May:       "May",
+			time.June:      "June",
+			time.July:      "July",
+			time.August:    "August",
+			time.September: "September",
+			time.October:   "October",
+			time.November:  "November",
+			time.December:  "December",
+		},
+		dateShort: "01/02/2006",
+		timeShort: "01/02/2006 15:04:05",
+		longDate: func(l locale, t time.Time) string {
+			return fmt.Sprintf("%s, %s %d, %d", l.days[t.Weekday()], l.months[t.Month()], t.Day(), t.Year())
+		},
+		abbrev: func(l locale, t time.Time) string {
+			return fmt.Sprintf("%s, %s %d, %d", abbreviate(l.days[t.Weekday()], 3), abbreviate(l.months[t.Month()], 3), t.Day(), t.Year())
+		},
+		decimalSep:   ".",
+		thousandsSep: ",",
+		symbolFirst:  true,
+	},
+}
+
+// format formats t with a named format like date-long, ok is false for unknown names
+func (l locale) format(t time.Time, name string) (s string, ok bool) {
+	switch name {
+	case "date-short":
+		return t.Format(l.dateShort), true
+	case "date-long":
+		return l.longDate(l, t), true
+	case "date-abbrev":
+		return l.abbrev(l, t), true
+	case "time-short":
+		return t.Format(l.timeShort), true
+	case "time-long":
+		return fmt.Sprintf("%s %02d:%02d:%02d", l.longDate(l, t), t.Hour(), t.Minute(), t.Second()), true
+	default:
+		return "", false
+	}
+}
+
+// localizedTimef returns timef which resolves formats without a locale suffix with the given locale
+func localizedTimef(tag string) func(time.Time, string) string {
+	if _, ok := locales[tag]; !ok {
+		tag = defaultLocale
+	}
+
+	return func(t time.Time, format string) string {
+		if i := strings.LastIndex(format, "-"); i != -1 {
+			if l, ok := locales[format[i+1:]]; ok {
+				if s, ok := l.format(t, format[:i]); ok {
+					return s
+				}
+			}
+		}
+
+		if s, ok := locales[tag].format(t, format); ok {
+			return s
+		}
+
+		return t.Format(format)
+	}
+}
+
+// localizedTimefIn returns timefIn which converts to the location before formatting like localizedTimef
+func localizedTimefIn(tag string) func(time.Time, string, string) (string, error) {
+	timef := localizedTimef(tag)
+
+	return func(t time.Time, location string, format string) (string, error) {
+		loc, err := time.LoadLocation(location)
+		if err != nil {
+			return "", fmt.Errorf("unknown location %q: %v", location, err)
+		}
+
+		return timef(t.In(loc), format), nil
+	}
+}
+
+// timef formats t with a named format like date-long-de or time-short-en, or a go layout
+var timef = localizedTimef(defaultLocale)
+
+// timefIn formats t in an IANA location like Europe/Berlin, it fails for unknown locations
+var timefIn = localizedTimefIn(defaultLocale)
+
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// formatDigits formats an integer part and optional fraction with the separators of the locale
+func (l locale) formatDigits(integer, fraction string) string {
+	neg := strings.HasPrefix(integer, "-")
+	integer = strings.TrimPrefix(integer, "-")
+
+	var b strings.Builder
+	if neg {
+		b.WriteByte('-')
+	}
+
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(l.thousandsSep)
+		}
+		b.WriteRune(c)
+	}
+
+	if fraction != "" {
+		b.WriteString(l.decimalSep)
+		b.WriteString(fraction)
+	}
+
+	return b.String()
+}
+
+// localizedNumber returns number which formats integers and floats with the separators of the locale,
+// e.g. {{number 1234567}} renders "1.234.567" for de
+func localizedNumber(tag string) func(interface{}) (string, error) {
+	l, ok := locales[tag]
+	if !ok {
+		l = locales[defaultLocale]
+	}
+
+	return func(n interface{}) (string, error) {
+		rv := reflect.ValueOf(n)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return l.formatDigits(strconv.FormatInt(rv.Int(), 10), ""), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return l.formatDigits(strconv.FormatUint(rv.Uint(), 10), ""), nil
+		case reflect.Float32, reflect.Float64:
+			integer, fraction, _ := strings.Cut(strconv.FormatFloat(rv.Float(), 'f', -1, 64), ".")
+			return l.formatDigits(integer, fraction), nil
+		default:
+			return "", fmt.Errorf("number expects an integer or float, got %T", n)
+		}
+	}
+}
+
+// localizedCurrency returns currency which formats an amount of the given currency code.
+// Integers are cents, floats are rounded half away from zero to cents,
+// e.g. {{currency 123456 "EUR"}} and {{currency 1234.56 "EUR"}} render "1.234,56 €" for de.
+func localizedCurrency(tag string) func(interface{}, string) (string, error) {
+	l, ok := locales[tag]
+	if !ok {
+		l = locales[defaultLocale]
+	}
+
+	return func(amount interface{}, code string) (string, error) {
+		var cents int64
+
+		rv := reflect.ValueOf(amount)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			cents = rv.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			cents = int64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			cents = int64(math.Round(rv.Float() * 100))
+		default:
+			return "", fmt.Errorf("currency expects cents or a float amount, got %T", amount)
+		}
+
+		sign := ""
+		if cents < 0 {
+			sign = "-"
+			cents = -cents
+		}
+
+		s := l.formatDigits(sign+strconv.FormatInt(cents/100, 10), fmt.Sprintf("%02d", cents%100))
+
+		symbol, ok := currencySymbols[strings.ToUpper(code)]
+		if !ok {
+			symbol = strings.ToUpper(code)
+		}
+
+		if l.symbolFirst && ok {
+			if sign != "" {
+				return "-" + symbol + strings.TrimPrefix(s, "-"), nil
+			}
+			return symbol + s, nil
+		}
+
+		return s + " " + symbol, nil
+	}
+}
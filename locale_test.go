@@ -0,0 +1,161 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f9a/mail"
+)
+
+func renderLocalized(t *testing.T, body string, options ...mail.Option) string {
+	t.Helper()
+
+	tpl, err := mail.NewTemplate("", body, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(map[string]interface{}{
+		"Created": time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return msg.Body
+}
+
+func TestTimefLocale(t *testing.T) {
+	tests := []struct {
+		body    string
+		options []mail.Option
+		want    string
+	}{
+		{body: `{{timef .Created "date-short-de"}}`, want: "02.01.2024"},
+		{body: `{{timef .Created "date-short-en"}}`, want: "01/02/2024"},
+		{body: `{{timef .Created "date-long-en"}}`, want: "Tuesday, January 2, 2024"},
+		{body: `{{timef .Created "time-long-en"}}`, want: "Tuesday, January 2, 2024 15:04:05"},
+		{body: `{{timef .Created "date-short"}}`, want: "02.01.2024"},
+		{body: `{{timef .Created "date-short"}}`, options: []mail.Option{mail.Locale("en")}, want: "01/02/2024"},
+		{body: `{{timef .Created "date-short-de"}}`, options: []mail.Option{mail.Locale("en")}, want: "02.01.2024"},
+		{body: `{{timef .Created "2006-01-02"}}`, options: []mail.Option{mail.Locale("en")}, want: "2024-01-02"},
+	}
+
+	for _, test := range tests {
+		if got := renderLocalized(t, test.body, test.options...); got != test.want {
+			t.Errorf("%v: expected %q, got %q", test.body, test.want, got)
+		}
+	}
+
+	if _, err := mail.NewTemplate("", "", mail.Locale("xx")); err == nil {
+		t.Error("expected error for unknown locale")
+	}
+}
+
+func TestTimefIn(t *testing.T) {
+	got := renderLocalized(t, `{{timefIn .Created "Europe/Berlin" "time-short-de"}}`)
+	if got != "02.01.2024 16:04:05" {
+		t.Errorf("expected time in Europe/Berlin, got %q", got)
+	}
+
+	got = renderLocalized(t, `{{timefIn .Created "America/New_York" "time-long"}}`, mail.Locale("en"))
+	if got != "Tuesday, January 2, 2024 10:04:05" {
+		t.Errorf("expected english time in America/New_York, got %q", got)
+	}
+
+	tpl, err := mail.NewTemplate("", `{{timefIn .Created "Mars/Olympus" "date-long"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tpl.Execute(map[string]interface{}{"Created": time.Now()})
+	if err == nil || !strings.Contains(err.Error(), `"Mars/Olympus"`) {
+		t.Errorf("expected error naming unknown location, got: %v", err)
+	}
+}
+
+func TestTimefGermanWeekdays(t *testing.T) {
+	tests := map[time.Weekday]string{
+		time.Monday:    "Montag, 01. Januar 2024",
+		time.Wednesday: "Mittwoch, 03. Januar 2024",
+		time.Saturday:  "Samstag, 06. Januar 2024",
+		time.Sunday:    "Sonntag, 07. Januar 2024",
+	}
+
+	for weekday, want := range tests {
+		d := time.Date(2024, time.January, int(weekday+6)%7+1, 0, 0, 0, 0, time.UTC)
+		if d.Weekday() != weekday {
+			t.Fatalf("wrong test date %v for %v", d, weekday)
+		}
+
+		if got := renderTimefAt(t, d, "date-long-de"); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+
+	march := time.Date(2024, time.March, 4, 8, 30, 0, 0, time.UTC)
+	if got := renderTimefAt(t, march, "date-abbrev-de"); got != "Mo, 04. März 2024" {
+		t.Errorf("unexpected abbreviated date: %q", got)
+	}
+
+	if got := renderTimefAt(t, march, "time-long-de"); got != "Montag, 04. März 2024 08:30:00" {
+		t.Errorf("unexpected long time: %q", got)
+	}
+
+	if got := renderTimefAt(t, march, "date-abbrev-en"); got != "Mon, Mar 4, 2024" {
+		t.Errorf("unexpected english abbreviated date: %q", got)
+	}
+}
+
+func renderTimefAt(t *testing.T, d time.Time, format string) string {
+	t.Helper()
+
+	tpl, err := mail.NewTemplate("", `{{timef . "`+format+`"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return msg.Body
+}
+
+func TestNumberAndCurrency(t *testing.T) {
+	tests := []struct {
+		body    string
+		options []mail.Option
+		want    string
+	}{
+		{body: `{{number 1234567}}`, want: "1.234.567"},
+		{body: `{{number 123}}`, want: "123"},
+		{body: `{{number -1234.5}}`, want: "-1.234,5"},
+		{body: `{{number 1234567}}`, options: []mail.Option{mail.Locale("en")}, want: "1,234,567"},
+		{body: `{{currency 123456 "EUR"}}`, want: "1.234,56 €"},
+		{body: `{{currency 1234.56 "EUR"}}`, want: "1.234,56 €"},
+		{body: `{{currency 0.005 "EUR"}}`, want: "0,01 €"},
+		{body: `{{currency -5 "EUR"}}`, want: "-0,05 €"},
+		{body: `{{currency 1999 "CHF"}}`, want: "19,99 CHF"},
+		{body: `{{currency 123456 "USD"}}`, options: []mail.Option{mail.Locale("en")}, want: "$1,234.56"},
+		{body: `{{currency -1234.56 "usd"}}`, options: []mail.Option{mail.Locale("en")}, want: "-$1,234.56"},
+		{body: `{{currency 1999 "CHF"}}`, options: []mail.Option{mail.Locale("en")}, want: "19.99 CHF"},
+	}
+
+	for _, test := range tests {
+		if got := renderLocalized(t, test.body, test.options...); got != test.want {
+			t.Errorf("%v: expected %q, got %q", test.body, test.want, got)
+		}
+	}
+
+	tpl, err := mail.NewTemplate("", `{{currency "12" "EUR"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = tpl.Execute(nil); err == nil {
+		t.Error("expected error for currency of string")
+	}
+}
@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler drops all records, it's used when Tx.Logger is nil
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// log returns Logger or a logger discarding everything
+func (tx *Tx) log() *slog.Logger {
+	if tx.Logger == nil {
+		return discardLogger
+	}
+
+	return tx.Logger
+}
+
+// logSend logs a sent or failed message, without subject, body or credentials
+func logSend(log *slog.Logger, info SendInfo, err error) {
+	attrs := []any{
+		slog.String("message_id", info.MessageID),
+		slog.Int("recipients", info.Recipients),
+		slog.Int("attachments", info.Attachments),
+		slog.Int("size", info.Size),
+		slog.Duration("elapsed", info.Elapsed),
+	}
+
+	if err != nil {
+		log.Error("mail not sent", append(attrs, slog.Any("error", err))...)
+		return
+	}
+
+	log.Info("mail sent", attrs...)
+}
+
+// logAttachments logs name, type and size of the attachments at debug level
+func logAttachments(log *slog.Logger, message Message) {
+	for _, a := range message.Attachments {
+		size := int64(len(a.Content))
+		if a.Open != nil {
+			size = a.size
+		}
+
+		log.Debug("attaching", slog.String("name", a.Name), slog.String("kind", a.Kind), slog.Int64("size", size), slog.Bool("inline", a.Inline))
+	}
+}
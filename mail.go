@@ -1,20 +1,34 @@
 package mail
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"log/slog"
 	"mime"
-	"os"
+	stdmail "net/mail"
+	"net/textproto"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	oz "github.com/go-ozzo/ozzo-validation/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/time/rate"
 	"gopkg.in/mail.v2"
 )
 
 type Sender interface {
 	Send(from string, to To, message Message, options ...SendOption) (err error)
+	// SendContext sends message and returns its Message-ID
+	SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error)
 }
 
 type ConfigurableSender interface {
@@ -31,53 +45,394 @@ type TxConfig struct {
 	User     string `json:"user" ini:"user" yaml:"user"`
 	Password string `json:"password" ini:"password" yaml:"password"`
 	Host     string `json:"host" ini:"host" yaml:"host"`
-	Port     int    `json:"port" ini:"port" yaml:"port"`
-	TmpDir   string `json:"tmpDir" ini:"tmp-dir" envconfig:"TMP_DIR" yaml:"tmpDir"`
+	// Port of the smtp server, defaults to DefaultPort
+	Port int `json:"port" ini:"port" yaml:"port"`
+	// Deprecated: TmpDir is not used anymore, attachments are sent from memory.
+	// It's not validated, a missing directory fails neither Dial nor Send.
+	TmpDir string `json:"tmpDir" ini:"tmp-dir" envconfig:"TMP_DIR" yaml:"tmpDir"`
+	// Timeout for connecting to and every exchange with the smtp server, defaults to DefaultTimeout
+	Timeout time.Duration `json:"timeout" ini:"timeout" yaml:"timeout"`
+	// TLSConfig is used for STARTTLS and SSL connections, defaults to a config verifying Host
+	TLSConfig *tls.Config `json:"-" ini:"-" yaml:"-"`
+	// InsecureSkipVerify disables verification of the server certificate, only use it for development
+	InsecureSkipVerify bool `json:"insecureSkipVerify" ini:"insecure-skip-verify" yaml:"insecureSkipVerify"`
+	// Encryption of the connection, defaults to SSL on port 465 and STARTTLS when supported by the server otherwise
+	Encryption Encryption `json:"encryption" ini:"encryption" yaml:"encryption"`
+	// ReuseConnection keeps the connection to the smtp server open for further sends until Tx.Close is called.
+	// Sends over the open connection are serialized.
+	ReuseConnection bool `json:"reuseConnection" ini:"reuse-connection" yaml:"reuseConnection"`
+	// LocalName is the hostname sent with EHLO, defaults to localhost
+	LocalName string `json:"localName" ini:"local-name" yaml:"localName"`
+	// AccessToken authenticates User with XOAUTH2 instead of Password, e.g. for Gmail or Office 365
+	AccessToken string `json:"accessToken" ini:"access-token" yaml:"accessToken"`
+	// TokenSource returns the XOAUTH2 access token of User, it's called for every connection so
+	// it can refresh expired tokens. It takes precedence over AccessToken. With golang.org/x/oauth2:
+	//
+	//	src := oauthConfig.TokenSource(ctx, refreshToken)
+	//	cfg.TokenSource = func(context.Context) (string, error) {
+	//		token, err := src.Token()
+	//		if err != nil {
+	//			return "", err
+	//		}
+	//		return token.AccessToken, nil
+	//	}
+	TokenSource func(ctx context.Context) (accessToken string, err error) `json:"-" ini:"-" yaml:"-"`
+	// AllowUnauthenticated sends without authentication, e.g. to an internal relay. User and Password are not required and not used.
+	AllowUnauthenticated bool `json:"allowUnauthenticated" ini:"allow-unauthenticated" yaml:"allowUnauthenticated"`
+	// DryRun builds and renders messages like a real send, but doesn't connect to the smtp server
+	DryRun bool `json:"dryRun" ini:"dry-run" yaml:"dryRun"`
+	// MessageIDDomain is the right-hand side of generated Message-IDs, e.g. the DKIM signing domain.
+	// Defaults to the domain of the from address, then Host.
+	MessageIDDomain string `json:"messageIdDomain" ini:"message-id-domain" yaml:"messageIdDomain"`
 }
 
+// Encryption is the encryption used for the connection to the smtp server
+type Encryption string
+
+const (
+	// EncryptionNone sends mails unencrypted
+	EncryptionNone Encryption = "none"
+	// EncryptionSTARTTLS upgrades the connection with STARTTLS, mails are not sent when the server doesn't support it
+	EncryptionSTARTTLS Encryption = "starttls"
+	// EncryptionSSL uses an implicit TLS connection, usually on port 465
+	EncryptionSSL Encryption = "ssl"
+)
+
+// DefaultPort is used when TxConfig.Port is not set
+const DefaultPort = 587
+
+// DefaultTimeout is used when TxConfig.Timeout is not set
+const DefaultTimeout = 10 * time.Second
+
+// hostnameRe matches hostnames and address literals, which are valid EHLO names
+var hostnameRe = regexp.MustCompile(`^(\[[0-9a-fA-F.:]+\]|[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)$`)
+
 func (cfg TxConfig) Validate() error {
+	port := cfg.port()
+
 	return oz.ValidateStruct(&cfg,
-		oz.Field(&cfg.User, oz.Required),
-		oz.Field(&cfg.Password, oz.Required),
+		oz.Field(&cfg.User, oz.When(!cfg.AllowUnauthenticated, oz.Required)),
+		oz.Field(&cfg.Password, oz.When(!cfg.AllowUnauthenticated && !cfg.usesXOAuth2(), oz.Required)),
 		oz.Field(&cfg.Host, oz.Required),
-		oz.Field(&cfg.Port, oz.Required, oz.Min(0), oz.Max(49151)),
+		oz.Field(&cfg.Port, oz.Min(0), oz.Max(49151)),
+		oz.Field(&cfg.Timeout, oz.Min(time.Duration(0))),
+		oz.Field(&cfg.LocalName, oz.Match(hostnameRe).Error("must be a hostname or an address literal like [192.0.2.1]")),
+		oz.Field(&cfg.MessageIDDomain, oz.Match(hostnameRe).Error("must be a domain")),
+		oz.Field(&cfg.Encryption,
+			oz.In(EncryptionNone, EncryptionSTARTTLS, EncryptionSSL),
+			oz.When(port == 25 || port == 587,
+				oz.NotIn(EncryptionSSL).Error("ssl is not used on port 25 or 587, use starttls")),
+			oz.When(port == 465,
+				oz.NotIn(EncryptionSTARTTLS).Error("starttls is not used on port 465, use ssl")),
+		),
 	)
 }
 
+func (cfg TxConfig) usesXOAuth2() bool {
+	return cfg.AccessToken != "" || cfg.TokenSource != nil
+}
+
+// messageIDDomain returns the right-hand side of generated Message-IDs of messages from from
+func (cfg TxConfig) messageIDDomain(from string) string {
+	if cfg.MessageIDDomain != "" {
+		return cfg.MessageIDDomain
+	}
+
+	if addr, err := stdmail.ParseAddress(from); err == nil {
+		return addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+	}
+
+	return cfg.Host
+}
+
+// port returns the configured port or DefaultPort
+func (cfg TxConfig) port() int {
+	if cfg.Port == 0 {
+		return DefaultPort
+	}
+
+	return cfg.Port
+}
+
+func newDialer(cfg TxConfig) *mail.Dialer {
+	user, password := cfg.User, cfg.Password
+	if cfg.AllowUnauthenticated {
+		// mail.v2 and dialContext skip AUTH without a user
+		user, password = "", ""
+	}
+
+	dialer := mail.NewDialer(cfg.Host, cfg.port(), user, password)
+	dialer.LocalName = cfg.LocalName
+	if !cfg.AllowUnauthenticated && cfg.usesXOAuth2() {
+		tokenSource := cfg.TokenSource
+		if tokenSource == nil {
+			token := cfg.AccessToken
+			tokenSource = func(context.Context) (string, error) { return token, nil }
+		}
+
+		dialer.Auth = &xoauth2Auth{username: user, tokenSource: tokenSource}
+	}
+	dialer.Timeout = cfg.Timeout
+	if dialer.Timeout == 0 {
+		dialer.Timeout = DefaultTimeout
+	}
+
+	switch cfg.Encryption {
+	case EncryptionNone:
+		dialer.SSL = false
+		dialer.StartTLSPolicy = mail.NoStartTLS
+	case EncryptionSTARTTLS:
+		dialer.SSL = false
+		dialer.StartTLSPolicy = mail.MandatoryStartTLS
+	case EncryptionSSL:
+		dialer.SSL = true
+	}
+
+	if cfg.TLSConfig != nil {
+		dialer.TLSConfig = cfg.TLSConfig.Clone()
+	}
+
+	if cfg.InsecureSkipVerify {
+		if dialer.TLSConfig == nil {
+			dialer.TLSConfig = &tls.Config{ServerName: cfg.Host}
+		}
+		dialer.TLSConfig.InsecureSkipVerify = true
+	}
+
+	return dialer
+}
+
 type Tx struct {
+	// OnSend is called after every message which was sent or failed, e.g. to record metrics.
+	// It can be nil and must be set before the transmitter is used.
+	OnSend func(info SendInfo, err error)
+	// Logger receives debug logs of connections and attachments, info logs of sent messages and
+	// error logs of failed ones. Bodies and credentials are never logged. Nothing is logged when it's nil,
+	// it must be set before the transmitter is used.
+	Logger *slog.Logger
+
+	// dialer is the dialerValue of the config
 	dialer atomic.Value
 	cfg    atomic.Value
+	// limiter is the *rate.Limiter set with RateLimit
+	limiter atomic.Value
+	// dkim are the *dkim.SignOptions set with WithDKIM
+	dkim atomic.Value
+
+	// connMu guards conn, the open connection when TxConfig.ReuseConnection is set
+	connMu sync.Mutex
+	conn   *smtpSender
+}
+
+// dialer opens new connections. *mail.Dialer is used with the context aware smtp implementation
+// of dialContext, other dialers like fakes in tests are dialed with Dial, see dialAndSendWith.
+type dialer interface {
+	Dial() (mail.SendCloser, error)
+}
+
+var _ dialer = &mail.Dialer{}
+
+// dialerValue wraps the dialer, so dialers of different types can be stored in Tx.dialer
+type dialerValue struct {
+	dialer dialer
+}
+
+func (tx *Tx) setDialer(d dialer) {
+	tx.dialer.Store(dialerValue{dialer: d})
+}
+
+// loadDialer returns the dialer and whether it's the *mail.Dialer of the config, ok is false until tx is configured
+func (tx *Tx) loadDialer() (d dialer, smtpDialer *mail.Dialer, ok bool) {
+	v, ok := tx.dialer.Load().(dialerValue)
+	if !ok {
+		return
+	}
+
+	smtpDialer, _ = v.dialer.(*mail.Dialer)
+	return v.dialer, smtpDialer, true
+}
+
+// RateLimit limits the messages sent per second, allowing bursts of up to burst messages.
+// Sends wait for the limit before they connect, a perSecond of zero or less removes the limit.
+// It's safe for concurrent use.
+func (tx *Tx) RateLimit(perSecond float64, burst int) {
+	if perSecond <= 0 {
+		tx.limiter.Store((*rate.Limiter)(nil))
+		return
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	tx.limiter.Store(rate.NewLimiter(rate.Limit(perSecond), burst))
+}
+
+// wait waits until the rate limit allows to send n messages or ctx is done
+func (tx *Tx) wait(ctx context.Context, n int) error {
+	limiter, _ := tx.limiter.Load().(*rate.Limiter)
+	if limiter == nil {
+		return nil
+	}
+
+	for i := 0; i < n; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendInfo describes a sent message for Tx.OnSend
+type SendInfo struct {
+	From      string
+	MessageID string
+	Subject   string
+	// Recipients is the number of to, cc and bcc recipients
+	Recipients  int
+	Attachments int
+	// Size is the size of the bodies and attachments before they are encoded
+	Size    int
+	Elapsed time.Duration
+}
+
+func newSendInfo(from string, to To, message Message, messageID string, options []SendOption, start time.Time) SendInfo {
+	opts := sendOptions{}
+	for _, o := range options {
+		o.apply(&opts)
+	}
+
+	size := len(message.Body)
+	for _, alt := range message.Alternatives {
+		size += len(alt.Body)
+	}
+	for _, a := range message.Attachments {
+		size += len(a.Content)
+	}
+
+	return SendInfo{
+		From:        from,
+		MessageID:   messageID,
+		Subject:     message.Topic,
+		Recipients:  len(to) + len(opts.cc) + len(opts.bcc),
+		Attachments: len(message.Attachments),
+		Size:        size,
+		Elapsed:     time.Since(start),
+	}
+}
+
+func (tx *Tx) notify(info SendInfo, err error) {
+	logSend(tx.log(), info, err)
+
+	if tx.OnSend != nil {
+		tx.OnSend(info, err)
+	}
 }
 
 // To represents to addresses
 type To []string
 
-func writeFile(tempDirName string, a Attachment) (filename string, err error) {
-	ee, err := mime.ExtensionsByType(a.Kind)
+// attachmentFilename is the name of the attachment with an extension matching its mime-type
+func attachmentFilename(a Attachment) (filename string, err error) {
+	// keep names as provided when they have an extension, e.g. report.2024.xlsx
+	if filepath.Ext(a.Name) != "" {
+		return a.Name, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(a.Kind)
 	if err != nil {
 		err = fmt.Errorf("Couldn't find extension for mime-type: %v", err)
 		return
 	}
 
-	var ext string
-	if ee == nil {
-		ext = "unknown"
-	} else {
-		ext = ee[0]
+	if ext, ok := registeredExtension(mediaType); ok {
+		return a.Name + ext, nil
+	}
+
+	// the system mime database maps binary content to many extensions, e.g. .dll or .exe
+	if mediaType == "application/octet-stream" {
+		return a.Name + defaultExtension, nil
 	}
 
-	filename = filepath.Join(tempDirName, fmt.Sprintf("%s%s", a.Name, ext))
-	err = ioutil.WriteFile(filename, a.Content, 0700)
+	ee, err := mime.ExtensionsByType(mediaType)
 	if err != nil {
-		err = fmt.Errorf("Couldn't write attachment to tmp-dir: %v", err)
+		err = fmt.Errorf("Couldn't find extension for mime-type: %v", err)
 		return
 	}
 
+	ext := defaultExtension
+	if len(ee) > 0 {
+		ext = ee[0]
+	}
+
+	return fmt.Sprintf("%s%s", a.Name, ext), nil
+}
+
+// defaultExtension is used for attachments of mime-types without known extension
+const defaultExtension = ".bin"
+
+var (
+	extensionsMu sync.RWMutex
+	extensions   = map[string]string{}
+)
+
+// RegisterExtension sets the extension of attachment filenames for mimeType, e.g. text/csv and .csv,
+// instead of the first one of the system mime database. An empty ext removes the override.
+// It is safe for concurrent use.
+func RegisterExtension(mimeType, ext string) error {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return fmt.Errorf("invalid mime-type %q: %v", mimeType, err)
+	}
+
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+
+	if ext == "" {
+		delete(extensions, mediaType)
+		return nil
+	}
+	extensions[mediaType] = ext
+
+	return nil
+}
+
+func registeredExtension(mediaType string) (ext string, ok bool) {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+
+	ext, ok = extensions[mediaType]
 	return
 }
 
 type sendOptions struct {
-	asCc bool
+	asCc    bool
+	cc      []string
+	bcc     []string
+	replyTo []string
+	headers map[string][]string
+
+	skipAddressValidation bool
+	validateMessage       bool
+	normalize             bool
+
+	// date of the Date header, the time of sending when zero
+	date time.Time
+	// returnPath is the bare envelope sender address, from is used when empty
+	returnPath string
+	// sender is the address of the Sender header
+	sender string
+
+	// err is the first error of an invalid option, the message is not sent with it
+	err error
+
+	retryAttempts int
+	retryBackoff  time.Duration
 }
 
 type SendOption interface {
@@ -90,79 +445,831 @@ func (fun sendOptionFunc) apply(o *sendOptions) {
 	fun(o)
 }
 
+// AsCc sends the message to the first address of to and all other addresses as Cc.
+//
+// Deprecated: Pass the primary recipients as to and use Cc instead.
 func AsCc() SendOption {
 	return sendOptionFunc(func(o *sendOptions) {
 		o.asCc = true
 	})
 }
 
-// Send sends message
+// Cc sends a copy of the message to addrs. The addresses can have display names, e.g. Address("Manager", "mgr@example.com")
+// or "Manager <mgr@example.com>", which are encoded as defined in RFC 2047. Raw and named addresses can be mixed.
+func Cc(addrs ...string) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		o.cc = append(o.cc, addrs...)
+	})
+}
+
+// Bcc sends a blind copy of the message to addrs, which can have display names like the ones of Cc
+func Bcc(addrs ...string) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		o.bcc = append(o.bcc, addrs...)
+	})
+}
+
+// ReplyTo sets the Reply-To header, empty addresses are ignored
+func ReplyTo(addrs ...string) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		for _, addr := range addrs {
+			if addr != "" {
+				o.replyTo = append(o.replyTo, addr)
+			}
+		}
+	})
+}
+
+// protectedHeaders can't be set with Header or Headers
+var protectedHeaders = map[string]struct{}{
+	"From":    {},
+	"To":      {},
+	"Subject": {},
+}
+
+// fail records the error of an invalid option, only the first one is kept
+func (o *sendOptions) fail(err error) {
+	if o.err == nil {
+		o.err = err
+	}
+}
+
+func (o *sendOptions) setHeader(key string, values ...string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if _, ok := protectedHeaders[key]; ok {
+		return
+	}
+
+	if o.headers == nil {
+		o.headers = map[string][]string{}
+	}
+	o.headers[key] = values
+}
+
+// newMessageID generates a unique Message-ID with domain as right-hand side
+func newMessageID(domain string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// messageID returns the Message-ID set with Header or generates a new one
+func (o *sendOptions) messageID(domain string) string {
+	if ids := o.headers["Message-Id"]; len(ids) > 0 && ids[0] != "" {
+		return ids[0]
+	}
+
+	if domain == "" {
+		domain = "localhost"
+	}
+
+	return newMessageID(domain)
+}
+
+// Header sets a custom header, e.g. X-Campaign-ID. It is applied after
+// all other headers, so it can override e.g. the Date header.
+// From, To and Subject can't be changed with it.
+func Header(key string, values ...string) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		o.setHeader(key, values...)
+	})
+}
+
+// Headers sets multiple custom headers like Header
+func Headers(headers map[string]string) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		for key, value := range headers {
+			o.setHeader(key, value)
+		}
+	})
+}
+
+// Unsubscribe sets the List-Unsubscribe header with a mailto address and/or an https url.
+// With an https url List-Unsubscribe-Post enables one-click unsubscribe as defined in RFC 8058.
+// At least one of both must be given.
+func Unsubscribe(mailto, httpsURL string) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		var targets []string
+		if mailto != "" {
+			targets = append(targets, "<mailto:"+strings.TrimPrefix(mailto, "mailto:")+">")
+		}
+
+		if httpsURL != "" {
+			if !strings.HasPrefix(httpsURL, "https://") {
+				o.fail(fmt.Errorf("unsubscribe url %q must be an https url", httpsURL))
+				return
+			}
+			targets = append(targets, "<"+httpsURL+">")
+		}
+
+		if len(targets) == 0 {
+			o.fail(errors.New("unsubscribe needs a mailto address or an https url"))
+			return
+		}
+
+		o.setHeader("List-Unsubscribe", strings.Join(targets, ", "))
+		if httpsURL != "" {
+			o.setHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+		}
+	})
+}
+
+// Priority of a message, shown by mail clients
+type Priority int
+
+const (
+	// PriorityNormal sets no priority headers
+	PriorityNormal Priority = iota
+	// PriorityLow marks the message as low priority
+	PriorityLow
+	// PriorityHigh marks the message as high priority, e.g. for alerts
+	PriorityHigh
+)
+
+var priorityHeaders = map[Priority]map[string]string{
+	PriorityLow:  {"X-Priority": "5 (Lowest)", "Importance": "low", "Priority": "non-urgent"},
+	PriorityHigh: {"X-Priority": "1 (Highest)", "Importance": "high", "Priority": "urgent"},
+}
+
+// WithPriority sets the X-Priority, Importance and Priority headers for level
+func WithPriority(level Priority) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		for _, key := range []string{"X-Priority", "Importance", "Priority"} {
+			delete(o.headers, key)
+		}
+
+		for key, value := range priorityHeaders[level] {
+			o.setHeader(key, value)
+		}
+	})
+}
+
+// Date sets the Date header to t instead of the time the message is sent,
+// e.g. for scheduled messages or reproducible tests.
+func Date(t time.Time) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		o.date = t
+	})
+}
+
+// ReturnPath sets the envelope sender (SMTP MAIL FROM) to addr, so bounces are
+// delivered to addr instead of the visible From address. The message carries it
+// as Return-Path header, which the receiving server replaces with the envelope sender.
+func ReturnPath(addr string) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		parsed, err := stdmail.ParseAddress(addr)
+		if err != nil {
+			o.fail(fmt.Errorf("invalid return-path %q: %v", addr, err))
+			return
+		}
+
+		o.returnPath = parsed.Address
+	})
+}
+
+// WithSender sets the Sender header to addr, e.g. when sending on behalf of the from address.
+// The header is only set when addr differs from the from address. The envelope sender is addr
+// as well, unless ReturnPath is used.
+func WithSender(addr string) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		if _, err := stdmail.ParseAddress(addr); err != nil {
+			o.fail(fmt.Errorf("invalid sender %q: %v", addr, err))
+			return
+		}
+
+		o.sender = addr
+	})
+}
+
+// SkipAddressValidation sends the message without validating the email-addresses before.
+// Addresses the smtp layer can't parse are still rejected when the message is sent.
+func SkipAddressValidation() SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		o.skipAddressValidation = true
+	})
+}
+
+// NormalizeRecipients trims the to, cc and bcc addresses, lowercases their domains and removes
+// duplicates, also across to, cc and bcc. The first occurrence of an address is kept.
+// Local parts are kept as they are, because they may be case-sensitive.
+func NormalizeRecipients() SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		o.normalize = true
+	})
+}
+
+// normalizeRecipients returns the normalized to and normalizes the cc and bcc addresses of o
+func (o *sendOptions) normalizeRecipients(to To) To {
+	seen := map[string]struct{}{}
+	normalize := func(addrs []string) (normalized []string) {
+		for _, addr := range addrs {
+			addr, key := normalizeAddress(addr)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			normalized = append(normalized, addr)
+		}
+		return
+	}
+
+	to = normalize(to)
+	o.cc = normalize(o.cc)
+	o.bcc = normalize(o.bcc)
+	return to
+}
+
+// normalizeAddress trims addr and lowercases its domain, key is the bare address to find duplicates.
+// Addresses which can't be parsed are only trimmed.
+func normalizeAddress(addr string) (normalized, key string) {
+	addr = strings.TrimSpace(addr)
+	parsed, err := stdmail.ParseAddress(addr)
+	if err != nil {
+		return addr, addr
+	}
+
+	if at := strings.LastIndex(parsed.Address, "@"); at >= 0 {
+		parsed.Address = parsed.Address[:at] + strings.ToLower(parsed.Address[at:])
+	}
+
+	return Address(parsed.Name, parsed.Address), parsed.Address
+}
+
+// ValidateMessage refuses to send messages which fail Message.Validate
+func ValidateMessage() SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		o.validateMessage = true
+	})
+}
+
+// Retry retries sending up to attempts times when it failed temporarily, e.g. with a 4xx response
+// or a reset connection. The first retry waits for backoff, every further retry waits twice as long.
+// Permanent errors like 5xx responses are not retried.
+func Retry(attempts int, backoff time.Duration) SendOption {
+	return sendOptionFunc(func(o *sendOptions) {
+		o.retryAttempts = attempts
+		o.retryBackoff = backoff
+	})
+}
+
+// validateAddresses returns an error listing all invalid addresses
+func validateAddresses(from string, to To, opts sendOptions) error {
+	var invalid []string
+	check := func(field string, addrs ...string) {
+		for _, addr := range addrs {
+			if _, err := stdmail.ParseAddress(addr); err != nil {
+				invalid = append(invalid, fmt.Sprintf("%s %q", field, addr))
+			}
+		}
+	}
+
+	check("from", from)
+	check("to", to...)
+	check("cc", opts.cc...)
+	check("bcc", opts.bcc...)
+	check("reply-to", opts.replyTo...)
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid email-addresses: %s", strings.Join(invalid, ", "))
+	}
+
+	return nil
+}
+
+// Address formats name and email as address, e.g. "Acme Support" <support@acme.com>.
+// Non-ASCII names are encoded as defined in RFC 2047.
+func Address(name, email string) string {
+	if name == "" {
+		return email
+	}
+
+	return (&stdmail.Address{Name: name, Address: email}).String()
+}
+
+// formatAddresses formats addresses with display names as defined in RFC 2047.
+// Addresses which can't be parsed are kept as they are.
+func formatAddresses(addrs ...string) []string {
+	formatted := make([]string, len(addrs))
+	for i, addr := range addrs {
+		formatted[i] = addr
+		if a, err := stdmail.ParseAddress(addr); err == nil {
+			formatted[i] = Address(a.Name, a.Address)
+		}
+	}
+
+	return formatted
+}
+
+// Send sends message to all addresses of to, use the Cc and Bcc options for further recipients.
+// to can be empty when the message has Cc or Bcc recipients, the To header is "Undisclosed recipients:;" then.
+// from can have a display name, e.g. "Acme Billing <billing@acme.com>". When the connection is authenticated
+// with an email-address as TxConfig.User, it's the envelope sender instead of from, unless ReturnPath or
+// WithSender is used.
 func (tx *Tx) Send(from string, to To, message Message, options ...SendOption) (err error) {
-	if from == "" {
-		return errors.New("from cannot be empty")
+	_, err = tx.SendContext(context.Background(), from, to, message, options...)
+	return
+}
+
+// SendAsync sends message like Send in a new goroutine and delivers the result on the returned channel.
+// The channel is buffered, so the goroutine finishes even when the result is never received.
+func (tx *Tx) SendAsync(from string, to To, message Message, options ...SendOption) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- tx.Send(from, to, message, options...)
+	}()
+
+	return result
+}
+
+// SendContext sends message. When ctx is done before the message is transmitted
+// the connection to the smtp server is closed and ctx.Err() is returned.
+// If ctx is done after the message was sent, but before the server confirmed it,
+// the message may still be delivered.
+//
+// The returned Message-ID is either the one set with the Header option or a generated one.
+func (tx *Tx) SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "mail.Send")
+	defer func() {
+		info := newSendInfo(from, to, message, messageID, options, start)
+		endSpan(span, info, err)
+		tx.notify(info, err)
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return
 	}
 
-	if len(to) == 0 {
-		return errors.New("at least one 'to' email-address must be given")
+	cfg, ok := tx.cfg.Load().(TxConfig)
+	if !ok {
+		err = errors.New("transmitter is not configured, yet")
+		return
 	}
+	span.SetAttributes(attribute.String("server.address", cfg.Host))
+
+	m, err := newMessage(from, to, message, cfg.messageIDDomain(from), options)
+	if err != nil {
+		return
+	}
+	messageID = m.GetHeader("Message-Id")[0]
+	logAttachments(tx.log(), message)
 
 	opts := sendOptions{}
 	for _, o := range options {
 		o.apply(&opts)
 	}
 
+	backoff := opts.retryBackoff
+	for attempt := 0; ; attempt++ {
+		if err = tx.wait(ctx, 1); err != nil {
+			return
+		}
+
+		err = tx.transmit(ctx, m)
+		if err == nil || attempt >= opts.retryAttempts || !isTemporary(err) {
+			return
+		}
+
+		tx.log().Warn("retrying send", slog.String("message_id", messageID), slog.Int("attempt", attempt+1), slog.Duration("backoff", backoff), slog.Any("error", err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// Outgoing is a message to send with SendMany. It can be stored as JSON and sent later
+// with tx.Send(o.From, o.To, o.Message, o.Options...), e.g. from an outbox.
+type Outgoing struct {
+	// From is the sender for Send, SendMany uses its from argument instead
+	From    string
+	To      To
+	Message Message
+	Options []SendOption
+}
+
+// SendMany sends all messages over one connection. It stops at the first message which couldn't be sent.
+func (tx *Tx) SendMany(from string, messages []Outgoing) (err error) {
 	cfg, ok := tx.cfg.Load().(TxConfig)
 	if !ok {
 		err = errors.New("transmitter is not configured, yet")
 		return
 	}
 
-	m := mail.NewMessage()
+	mm := make([]*mail.Message, 0, len(messages))
+	for i, o := range messages {
+		var m *mail.Message
+		m, err = newMessage(from, o.To, o.Message, cfg.messageIDDomain(from), o.Options)
+		if err != nil {
+			err = fmt.Errorf("couldn't build message %d: %v", i+1, err)
+			return
+		}
+
+		mm = append(mm, m)
+	}
+
+	start := time.Now()
+	if err = tx.wait(context.Background(), len(mm)); err == nil {
+		err = tx.transmit(context.Background(), mm...)
+	}
+	for i, o := range messages {
+		tx.notify(newSendInfo(from, o.To, o.Message, mm[i].GetHeader("Message-Id")[0], o.Options, start), err)
+	}
 
-	m.SetHeader("From", from)
-	m.SetHeader("To", to[0])
-	if len(to) > 1 {
-		if opts.asCc {
-			m.SetHeader("Cc", to[1:]...)
-		} else {
-			m.SetHeader("Bcc", to[1:]...)
+	return
+}
+
+// BatchItem is a message to send with SendBatch
+type BatchItem struct {
+	To      To
+	Message Message
+	Options []SendOption
+
+	// envelopeTo replaces the recipients of the headers as envelope recipients, e.g. for the copies of SendRoles
+	envelopeTo []string
+}
+
+// SendBatch sends all items over one connection and returns an error for every item,
+// which is nil when the item was sent. A failing item doesn't stop the remaining ones.
+// When ctx is done the remaining items are not sent and their error is ctx.Err().
+func (tx *Tx) SendBatch(ctx context.Context, from string, items []BatchItem) []error {
+	errs := make([]error, len(items))
+	fail := func(from int, err error) []error {
+		for i := from; i < len(errs); i++ {
+			errs[i] = err
 		}
+
+		return errs
 	}
-	m.SetHeader("Subject", message.Topic)
-	m.SetBody(message.ContentType, message.Body)
 
-	tempDirName, err := ioutil.TempDir(cfg.TmpDir, "f9a-mail")
-	if err != nil {
-		return fmt.Errorf("couldn't create tmp-dir for attachments: %v", err)
+	cfg, ok := tx.cfg.Load().(TxConfig)
+	if !ok {
+		return fail(0, errors.New("transmitter is not configured, yet"))
 	}
+
+	d, dialer, ok := tx.loadDialer()
+	if !ok {
+		return fail(0, errors.New("transmitter is not configured, yet"))
+	}
+
+	var s *smtpSender
 	defer func() {
-		err = os.RemoveAll(tempDirName)
+		if s != nil {
+			s.Close()
+		}
 	}()
 
-	for _, a := range message.Attachments {
-		filename, err := writeFile(tempDirName, a)
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			return fail(i, err)
+		}
+
+		start := time.Now()
+		info := func(messageID string) SendInfo {
+			info := newSendInfo(from, item.To, item.Message, messageID, item.Options, start)
+			if item.envelopeTo != nil {
+				info.Recipients = len(item.envelopeTo)
+			}
+
+			return info
+		}
+
+		m, err := newMessage(from, item.To, item.Message, cfg.messageIDDomain(from), item.Options)
 		if err != nil {
+			errs[i] = err
+			tx.notify(info(""), err)
+			continue
+		}
+		messageID := m.GetHeader("Message-Id")[0]
+
+		// notify once the item was sent or failed
+		notify := func() {
+			tx.notify(info(messageID), errs[i])
+		}
+
+		if err = tx.wait(ctx, 1); err != nil {
+			fail(i, err)
+			notify()
+			return errs
+		}
+
+		if cfg.DryRun {
+			errs[i] = dryRun(m)
+			notify()
+			continue
+		}
+
+		if dialer == nil {
+			errs[i] = dialAndSendWith(d, item.envelopeTo, m)
+			notify()
+			continue
+		}
+
+		if s == nil {
+			s, err = dialContext(ctx, dialer, tx.log())
+			if err != nil {
+				s = nil
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				}
+				fail(i, err)
+				notify()
+				return errs
+			}
+		}
+
+		s.dkim = tx.dkimOptions()
+		if item.envelopeTo != nil {
+			errs[i] = s.sendTo(ctx, m, item.envelopeTo)
+		} else {
+			errs[i] = s.send(ctx, m)
+		}
+		if errs[i] != nil && ctx.Err() != nil {
+			errs[i] = ctx.Err()
+		}
+		notify()
+
+		if errs[i] != nil {
+			if ctx.Err() != nil {
+				return fail(i, ctx.Err())
+			}
+
+			// dial again for the remaining items when the connection broke
+			if !s.alive() {
+				s.rawConn.Close()
+				s = nil
+			}
+		}
+	}
+
+	return errs
+}
+
+// MergeRecipient is a recipient of SendMerge with its own template data and send options,
+// e.g. an Unsubscribe link per recipient
+type MergeRecipient struct {
+	Address string
+	Data    interface{}
+	Options []SendOption
+}
+
+// SendMerge renders tpl for every recipient with its data and sends the messages individually
+// over one connection like SendBatch. It returns an error for every recipient, which is nil
+// when the message was sent. Recipients whose message can't be rendered are skipped.
+func (tx *Tx) SendMerge(ctx context.Context, from string, tpl Template, recipients []MergeRecipient) []error {
+	errs := make([]error, len(recipients))
+	items := make([]BatchItem, 0, len(recipients))
+	// indexes maps the items to the recipients
+	indexes := make([]int, 0, len(recipients))
+
+	for i, r := range recipients {
+		message, err := tpl.Execute(r.Data)
+		if err != nil {
+			errs[i] = fmt.Errorf("couldn't render message for %v: %v", r.Address, err)
+			continue
+		}
+
+		items = append(items, BatchItem{To: To{r.Address}, Message: message, Options: r.Options})
+		indexes = append(indexes, i)
+	}
+
+	for i, err := range tx.SendBatch(ctx, from, items) {
+		errs[indexes[i]] = err
+	}
+
+	return errs
+}
+
+// Role of a recipient of SendRoles
+type Role string
+
+const (
+	// RoleTo is a primary recipient, listed in the To header of all copies
+	RoleTo Role = "to"
+	// RoleCc is a recipient of a copy, listed in the Cc header of all copies
+	RoleCc Role = "cc"
+	// RoleBcc is a recipient of a blind copy, it's not listed in any header
+	RoleBcc Role = "bcc"
+)
+
+// RoleRecipient is a recipient of SendRoles with its role, template data and send options,
+// e.g. personal data for the primary recipient and generic data for the managers in Cc
+type RoleRecipient struct {
+	Address string
+	Role    Role
+	Data    interface{}
+	Options []SendOption
+}
+
+// RoleResult is the outcome of SendRoles for Recipient: the Message rendered for it and the
+// error, which is nil when the message was sent
+type RoleResult struct {
+	Recipient RoleRecipient
+	Message   Message
+	Err       error
+}
+
+// SendRoles renders tpl for every recipient with its data and sends every recipient its own copy.
+// All copies have the same To and Cc headers, listing the recipients with RoleTo and RoleCc, so
+// everybody sees who got the message, but every copy is only delivered to its recipient.
+// Recipients with an invalid address or an unknown role fail without being listed in the headers.
+// The copies are sent over one connection like SendBatch, which is dialed again when it broke.
+// It returns a result for every recipient in the order of recipients, a failing recipient doesn't
+// stop the remaining ones. Recipients whose message can't be rendered are skipped.
+func (tx *Tx) SendRoles(ctx context.Context, from string, tpl Template, recipients []RoleRecipient) []RoleResult {
+	results := make([]RoleResult, len(recipients))
+
+	// invalid recipients are left out of the headers, so they don't break the copies of the others
+	var to, cc []string
+	for i, r := range recipients {
+		results[i].Recipient = r
+
+		if _, err := stdmail.ParseAddress(r.Address); err != nil {
+			results[i].Err = fmt.Errorf("invalid email-address %q: %v", r.Address, err)
+			continue
+		}
+
+		switch r.Role {
+		case RoleTo:
+			to = append(to, r.Address)
+		case RoleCc:
+			cc = append(cc, r.Address)
+		case RoleBcc:
+		default:
+			results[i].Err = fmt.Errorf("unknown role %q of %v", r.Role, r.Address)
+		}
+	}
+
+	items := make([]BatchItem, 0, len(recipients))
+	// indexes maps the items to the recipients
+	indexes := make([]int, 0, len(recipients))
+
+	for i, r := range recipients {
+		if results[i].Err != nil {
+			continue
+		}
+
+		message, err := tpl.Execute(r.Data)
+		if err != nil {
+			results[i].Err = fmt.Errorf("couldn't render message for %v: %v", r.Address, err)
+			continue
+		}
+		results[i].Message = message
+
+		options := r.Options
+		if len(cc) > 0 {
+			options = append([]SendOption{Cc(cc...)}, options...)
+		}
+		// a blind copy has the undisclosed recipients To header, when there are no To and Cc recipients
+		if r.Role == RoleBcc {
+			options = append([]SendOption{Bcc(r.Address)}, options...)
+		}
+
+		items = append(items, BatchItem{To: to, Message: message, Options: options, envelopeTo: []string{bareAddress(r.Address)}})
+		indexes = append(indexes, i)
+	}
+
+	for i, err := range tx.SendBatch(ctx, from, items) {
+		results[indexes[i]].Err = err
+	}
+
+	return results
+}
+
+// dryRun renders the messages without sending them, so rendering errors surface like in a real send
+func dryRun(m ...*mail.Message) error {
+	for _, msg := range m {
+		if _, err := msg.WriteTo(io.Discard); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
 
-		m.Attach(filename)
+// transmit sends the messages over a new or, when configured, the open connection
+func (tx *Tx) transmit(ctx context.Context, m ...*mail.Message) (err error) {
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	cfg, _ := tx.cfg.Load().(TxConfig)
+	if cfg.DryRun {
+		return dryRun(m...)
 	}
 
-	dialer, ok := tx.dialer.Load().(*mail.Dialer)
+	d, dialer, ok := tx.loadDialer()
 	if !ok {
-		err = errors.New("transmitter is not configured, yet")
+		return errors.New("transmitter is not configured, yet")
+	}
+
+	if dialer == nil {
+		return dialAndSendWith(d, nil, m...)
+	}
+
+	if !cfg.ReuseConnection {
+		return dialAndSend(ctx, dialer, tx.log(), tx.dkimOptions(), m...)
+	}
+
+	tx.connMu.Lock()
+	defer tx.connMu.Unlock()
+
+	if tx.conn != nil && !tx.conn.alive() {
+		tx.conn.rawConn.Close()
+		tx.conn = nil
+	}
+
+	if tx.conn == nil {
+		tx.conn, err = dialContext(ctx, dialer, tx.log())
+		if err != nil {
+			return
+		}
+	}
+
+	tx.conn.dkim = tx.dkimOptions()
+	err = tx.conn.send(ctx, m...)
+	if err != nil {
+		tx.conn.rawConn.Close()
+		tx.conn = nil
+	}
+
+	return
+}
+
+// Ping connects and authenticates to the smtp server and closes the connection again,
+// e.g. to check the config on startup. ctx limits the time for connecting.
+// It doesn't connect when TxConfig.DryRun is set.
+func (tx *Tx) Ping(ctx context.Context) (err error) {
+	cfg, ok := tx.cfg.Load().(TxConfig)
+	if !ok {
+		return errors.New("transmitter is not configured, yet")
+	}
+
+	if cfg.DryRun {
+		return nil
+	}
+
+	_, dialer, ok := tx.loadDialer()
+	if !ok {
+		return errors.New("transmitter is not configured, yet")
+	}
+
+	if dialer == nil {
+		// there is no connection to check with a fake dialer
+		return nil
+	}
+
+	s, err := dialContext(ctx, dialer, tx.log())
+	if err != nil {
 		return
 	}
 
-	err = dialer.DialAndSend(m)
+	return s.Close()
+}
+
+// Close closes the open connection to the smtp server, if there is one
+func (tx *Tx) Close() (err error) {
+	tx.connMu.Lock()
+	defer tx.connMu.Unlock()
+
+	if tx.conn == nil {
+		return nil
+	}
+
+	err = tx.conn.Close()
+	tx.conn = nil
 
 	return
 }
 
 // UpdateTxConfig tx config. Is safe for concurrenct use.
+// An open connection is closed, so the next send uses the new config.
 func (tx *Tx) UpdateTxConfig(cfg TxConfig) {
+	tx.connMu.Lock()
+	defer tx.connMu.Unlock()
+
 	tx.cfg.Store(cfg)
-	tx.dialer.Store(mail.NewDialer(cfg.Host, cfg.Port, cfg.User, cfg.Password))
+	tx.setDialer(newDialer(cfg))
+
+	if tx.conn != nil {
+		tx.conn.Close()
+		tx.conn = nil
+	}
+}
+
+// Configured reports whether tx has a config, i.e. it was created with Dial or UpdateTxConfig was called.
+// It doesn't check whether the smtp server is reachable, see Ping.
+func (tx *Tx) Configured() bool {
+	_, hasCfg := tx.cfg.Load().(TxConfig)
+	_, _, hasDialer := tx.loadDialer()
+
+	return hasCfg && hasDialer
 }
 
 // Dial creates a new smtp transmitter and creates a dialer with passed config.
@@ -173,7 +1280,7 @@ func Dial(cfg TxConfig) (tx *Tx, err error) {
 	}
 
 	tx.cfg.Store(cfg)
-	tx.dialer.Store(mail.NewDialer(cfg.Host, cfg.Port, cfg.User, cfg.Password))
+	tx.setDialer(newDialer(cfg))
 
 	return
 }
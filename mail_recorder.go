@@ -2,13 +2,22 @@ package mail
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	stdmail "net/mail"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 )
 
 type Mail struct {
-	From    string
-	To      To
-	Message Message
+	From      string  `json:"from"`
+	To        To      `json:"to"`
+	Message   Message `json:"message"`
+	MessageID string  `json:"messageId"`
 }
 
 type Recorder interface {
@@ -22,64 +31,261 @@ type ConfigurableRecorder interface {
 	TxConfig() *TxConfig
 }
 
+// MemRecorder records mails in memory, it is safe for concurrent use.
 type MemRecorder struct {
+	// Mails are the recorded mails, only access them directly when no mails are sent concurrently
 	Mails []Mail
-	cfg   atomic.Value
+	// Capacity limits the recorded mails to the most recent ones, the oldest mails are
+	// removed when a new mail exceeds it. Zero or less records all mails.
+	Capacity int
+	mu       sync.RWMutex
+	cfg      atomic.Value
 }
 
-func (r *MemRecorder) Seen(m Mail) (ok bool, err error) {
-	if len(r.Mails) == 0 {
-		return false, nil
+// sameMail reports whether r matches m, the Message-ID is not compared.
+// With anyOrder the recipients can be in any order.
+func sameMail(r, m Mail, anyOrder bool) bool {
+	if r.From != m.From {
+		return false
 	}
 
-	for _, r := range r.Mails {
-		if r.From != m.From {
-			return false, nil
-		}
+	if len(r.To) != len(m.To) {
+		return false
+	}
 
-		if len(r.To) != len(m.To) {
-			return false, nil
-		}
+	rTo, mTo := r.To, m.To
+	if anyOrder {
+		rTo, mTo = append(To{}, rTo...), append(To{}, mTo...)
+		sort.Strings(rTo)
+		sort.Strings(mTo)
+	}
 
-		for i, to := range r.To {
-			if to != m.To[i] {
-				return false, nil
-			}
+	for i, to := range rTo {
+		if to != mTo[i] {
+			return false
 		}
+	}
+
+	if r.Message.Body != m.Message.Body ||
+		r.Message.ContentType != m.Message.ContentType ||
+		r.Message.Topic != m.Message.Topic {
+		return false
+	}
+
+	if len(r.Message.Alternatives) != len(m.Message.Alternatives) {
+		return false
+	}
 
-		if r.Message.Body != m.Message.Body ||
-			r.Message.ContentType != m.Message.ContentType ||
-			r.Message.Topic != m.Message.Topic {
-			return false, nil
+	for i, alt := range r.Message.Alternatives {
+		if alt != m.Message.Alternatives[i] {
+			return false
 		}
+	}
+
+	if len(r.Message.Attachments) != len(m.Message.Attachments) {
+		return false
+	}
 
-		if len(r.Message.Attachments) != len(m.Message.Attachments) {
-			return false, nil
+	for i, a := range r.Message.Attachments {
+		a2 := m.Message.Attachments[i]
+		if !bytes.Equal(a.Content, a2.Content) ||
+			a.Kind != a2.Kind ||
+			a.Name != a2.Name ||
+			a.Inline != a2.Inline {
+			return false
 		}
+	}
 
-		for i, a := range r.Message.Attachments {
-			a2 := m.Message.Attachments[i]
-			if !bytes.Equal(a.Content, a2.Content) ||
-				a.Kind != a2.Kind ||
-				a.Name != a2.Name {
-				return false, nil
-			}
+	return true
+}
+
+// Seen reports whether any recorded mail matches m
+func (r *MemRecorder) Seen(m Mail) (ok bool, err error) {
+	return r.seen(m, false), nil
+}
+
+// SeenLoose is like Seen but the recipients of m can be in any order
+func (r *MemRecorder) SeenLoose(m Mail) (ok bool, err error) {
+	return r.seen(m, true), nil
+}
+
+func (r *MemRecorder) seen(m Mail, anyOrder bool) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, recorded := range r.Mails {
+		if sameMail(recorded, m, anyOrder) {
+			return true
 		}
 	}
 
-	return true, nil
+	return false
 }
 
 func (r *MemRecorder) Send(from string, to To, message Message, options ...SendOption) (err error) {
+	_, err = r.SendContext(context.Background(), from, to, message, options...)
+	return
+}
+
+func (r *MemRecorder) SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	opts := sendOptions{}
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	messageID = opts.messageID(r.TxConfig().messageIDDomain(from))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.Mails = append(r.Mails, Mail{
-		From:    from,
-		To:      to,
-		Message: message,
+		From:      from,
+		To:        to,
+		Message:   message,
+		MessageID: messageID,
 	})
+	r.evict()
+
+	return messageID, nil
+}
+
+// Reset removes all recorded mails
+func (r *MemRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Mails = nil
+}
+
+// Len returns the number of recorded mails
+func (r *MemRecorder) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.Mails)
+}
+
+// Last returns the most recently recorded mail, ok is false when no mail was recorded
+func (r *MemRecorder) Last() (m Mail, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.Mails) == 0 {
+		return
+	}
+
+	return r.Mails[len(r.Mails)-1], true
+}
+
+// copyMail returns a copy of m which shares no slices with m
+func copyMail(m Mail) Mail {
+	m.To = append(To(nil), m.To...)
+	m.Message.Alternatives = append([]Alternative(nil), m.Message.Alternatives...)
+
+	attachments := make([]Attachment, len(m.Message.Attachments))
+	for i, a := range m.Message.Attachments {
+		a.Content = append([]byte(nil), a.Content...)
+		attachments[i] = a
+	}
+	if m.Message.Attachments != nil {
+		m.Message.Attachments = attachments
+	}
+
+	return m
+}
+
+// Filter returns copies of the recorded mails for which keep returns true, in the order they were sent
+func (r *MemRecorder) Filter(keep func(Mail) bool) []Mail {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var mails []Mail
+	for _, m := range r.Mails {
+		if keep(m) {
+			mails = append(mails, copyMail(m))
+		}
+	}
+
+	return mails
+}
+
+// FindByRecipient returns the mails sent to addr, display names and the case of addresses are ignored
+func (r *MemRecorder) FindByRecipient(addr string) []Mail {
+	addr = bareAddress(addr)
+	return r.Filter(func(m Mail) bool {
+		for _, to := range m.To {
+			if strings.EqualFold(bareAddress(to), addr) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// FindBySubject returns the mails whose topic contains substr
+func (r *MemRecorder) FindBySubject(substr string) []Mail {
+	return r.Filter(func(m Mail) bool {
+		return strings.Contains(m.Message.Topic, substr)
+	})
+}
+
+// bareAddress returns the email address of addr without display name, or addr when it can't be parsed
+func bareAddress(addr string) string {
+	parsed, err := stdmail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+
+	return parsed.Address
+}
+
+// Dump writes the recorded mails as json to w, attachment content is base64 encoded
+func (r *MemRecorder) Dump(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	mails := r.Mails
+	if mails == nil {
+		mails = []Mail{}
+	}
+
+	return json.NewEncoder(w).Encode(mails)
+}
+
+// Load replaces the recorded mails with the ones written by Dump
+func (r *MemRecorder) Load(rd io.Reader) (err error) {
+	mails := []Mail{}
+	if err = json.NewDecoder(rd).Decode(&mails); err != nil {
+		return fmt.Errorf("couldn't decode recorded mails: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Mails = mails
+	r.evict()
 
 	return nil
 }
 
+// evict removes the oldest mails exceeding Capacity, r.mu must be locked
+func (r *MemRecorder) evict() {
+	if r.Capacity <= 0 || len(r.Mails) <= r.Capacity {
+		return
+	}
+
+	n := copy(r.Mails, r.Mails[len(r.Mails)-r.Capacity:])
+	// clear the evicted mails, so they can be garbage collected
+	for i := n; i < len(r.Mails); i++ {
+		r.Mails[i] = Mail{}
+	}
+	r.Mails = r.Mails[:n]
+}
+
 func (r *MemRecorder) UpdateTxConfig(cfg TxConfig) {
 	r.cfg.Store(cfg)
 }
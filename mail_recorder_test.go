@@ -0,0 +1,290 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestMemRecorderSeenAlternatives(t *testing.T) {
+	message := mail.Message{
+		Topic:       "topic",
+		Body:        "Hi",
+		ContentType: "text/plain",
+		Alternatives: []mail.Alternative{
+			{ContentType: "text/html", Body: "<p>Hi</p>"},
+		},
+	}
+
+	r := &mail.MemRecorder{}
+	err := r.Send("test@example.de", mail.To{"ava@example.de"}, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen, err := r.Seen(mail.Mail{From: "test@example.de", To: mail.To{"ava@example.de"}, Message: message})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seen {
+		t.Error("expected mail with same alternatives to be seen")
+	}
+
+	other := message
+	other.Alternatives = []mail.Alternative{{ContentType: "text/html", Body: "<p>Bye</p>"}}
+	seen, err = r.Seen(mail.Mail{From: "test@example.de", To: mail.To{"ava@example.de"}, Message: other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen {
+		t.Error("expected mail with different alternatives not to be seen")
+	}
+}
+
+func TestMemRecorderMessageID(t *testing.T) {
+	r := &mail.MemRecorder{}
+
+	id, err := r.SendContext(context.Background(), "test@example.de", mail.To{"ava@example.de"}, mail.Message{},
+		mail.Header("Message-ID", "<custom@example.de>"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != "<custom@example.de>" || r.Mails[0].MessageID != id {
+		t.Errorf("expected recorded Message-ID %v, got %v", id, r.Mails[0].MessageID)
+	}
+}
+
+func TestMemRecorderSeen(t *testing.T) {
+	mails := []mail.Mail{
+		{From: "test@example.de", To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "one", Body: "1"}},
+		{From: "test@example.de", To: mail.To{"ben@example.de"}, Message: mail.Message{Topic: "two", Body: "2"}},
+		{From: "other@example.de", To: mail.To{"ava@example.de", "ben@example.de"}, Message: mail.Message{Topic: "three"}},
+	}
+
+	orders := map[string][]int{
+		"in order": {0, 1, 2},
+		"reversed": {2, 1, 0},
+		"mixed":    {1, 2, 0},
+	}
+
+	for name, order := range orders {
+		t.Run(name, func(t *testing.T) {
+			r := &mail.MemRecorder{}
+			for _, i := range order {
+				m := mails[i]
+				if err := r.Send(m.From, m.To, m.Message); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, m := range mails {
+				seen, err := r.Seen(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !seen {
+					t.Errorf("expected %v to be seen", m.Message.Topic)
+				}
+			}
+
+			seen, err := r.Seen(mail.Mail{From: "test@example.de", To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "two", Body: "2"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen {
+				t.Error("expected mail mixing fields of recorded mails not to be seen")
+			}
+		})
+	}
+
+	seen, err := (&mail.MemRecorder{}).Seen(mails[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen {
+		t.Error("expected empty recorder to have seen nothing")
+	}
+}
+
+func TestMemRecorderSeenLoose(t *testing.T) {
+	r := &mail.MemRecorder{}
+	message := mail.Message{Topic: "topic", Body: "body"}
+	if err := r.Send("test@example.de", mail.To{"ava@example.de", "ben@example.de"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	reordered := mail.Mail{From: "test@example.de", To: mail.To{"ben@example.de", "ava@example.de"}, Message: message}
+	if seen, _ := r.Seen(reordered); seen {
+		t.Error("expected Seen to compare the order of the recipients")
+	}
+
+	if seen, _ := r.SeenLoose(reordered); !seen {
+		t.Error("expected SeenLoose to ignore the order of the recipients")
+	}
+
+	tests := map[string]mail.Mail{
+		"other recipients": {From: "test@example.de", To: mail.To{"ben@example.de", "carl@example.de"}, Message: message},
+		"duplicate":        {From: "test@example.de", To: mail.To{"ben@example.de", "ben@example.de"}, Message: message},
+		"fewer recipients": {From: "test@example.de", To: mail.To{"ben@example.de"}, Message: message},
+		"other body":       {From: "test@example.de", To: mail.To{"ben@example.de", "ava@example.de"}, Message: mail.Message{Topic: "topic", Body: "other"}},
+	}
+	for name, m := range tests {
+		if seen, _ := r.SeenLoose(m); seen {
+			t.Errorf("%v: expected mail not to be seen", name)
+		}
+	}
+}
+
+func TestMemRecorderConcurrentSend(t *testing.T) {
+	r := &mail.MemRecorder{}
+	m := mail.Mail{From: "test@example.de", To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "topic"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Send(m.From, m.To, m.Message); err != nil {
+				t.Error(err)
+			}
+			if _, err := r.Seen(m); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(r.Mails) != 50 {
+		t.Errorf("expected 50 recorded mails, got %v", len(r.Mails))
+	}
+}
+
+func TestMemRecorderResetLenLast(t *testing.T) {
+	r := &mail.MemRecorder{}
+
+	if _, ok := r.Last(); ok {
+		t.Error("expected no last mail for empty recorder")
+	}
+
+	for _, topic := range []string{"one", "two"} {
+		if err := r.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: topic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if r.Len() != 2 {
+		t.Errorf("expected 2 mails, got %v", r.Len())
+	}
+
+	last, ok := r.Last()
+	if !ok || last.Message.Topic != "two" {
+		t.Errorf("expected last mail with topic two, got %+v", last)
+	}
+
+	r.Reset()
+	if r.Len() != 0 {
+		t.Errorf("expected no mails after reset, got %v", r.Len())
+	}
+}
+
+func TestMemRecorderDumpLoad(t *testing.T) {
+	r := &mail.MemRecorder{}
+
+	message := mail.Message{
+		Topic:       "topic",
+		Body:        "Hi",
+		ContentType: "text/plain",
+		Attachments: []mail.Attachment{{Name: "binary", Kind: "application/octet-stream", Content: []byte{0, 1, 2, 255, '\n'}}},
+	}
+	if err := r.Send("test@example.de", mail.To{"ava@example.de"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &mail.MemRecorder{}
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(r.Mails, loaded.Mails) {
+		t.Errorf("expected %+v, got %+v", r.Mails, loaded.Mails)
+	}
+
+	if err := loaded.Load(strings.NewReader("{")); err == nil {
+		t.Error("expected error for invalid json")
+	}
+}
+
+func TestMemRecorderFind(t *testing.T) {
+	r := &mail.MemRecorder{}
+
+	for _, m := range []mail.Mail{
+		{To: mail.To{"Alice <Alice@example.com>"}, Message: mail.Message{Topic: "Password reset"}},
+		{To: mail.To{"bob@example.com"}, Message: mail.Message{Topic: "Password reset"}},
+		{To: mail.To{"alice@example.com"}, Message: mail.Message{Topic: "Welcome", Attachments: []mail.Attachment{
+			{Name: "logo", Kind: "image/png", Content: []byte("png")},
+		}}},
+	} {
+		if err := r.Send("test@example.de", m.To, m.Message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := r.FindByRecipient("alice@example.com"); len(got) != 2 || got[0].Message.Topic != "Password reset" || got[1].Message.Topic != "Welcome" {
+		t.Errorf("expected both mails to alice, got %+v", got)
+	}
+
+	if got := r.FindBySubject("reset"); len(got) != 2 {
+		t.Errorf("expected 2 reset mails, got %+v", got)
+	}
+
+	got := r.Filter(func(m mail.Mail) bool {
+		return len(m.Message.Attachments) > 0
+	})
+	if len(got) != 1 {
+		t.Fatalf("expected one mail with attachments, got %+v", got)
+	}
+
+	got[0].To[0] = "mallory@example.com"
+	got[0].Message.Attachments[0].Content[0] = 'x'
+	if r.Mails[2].To[0] != "alice@example.com" || string(r.Mails[2].Message.Attachments[0].Content) != "png" {
+		t.Error("expected filtered mails to be copies")
+	}
+
+	if got := r.FindBySubject("missing"); len(got) != 0 {
+		t.Errorf("expected no mails, got %+v", got)
+	}
+}
+
+func TestMemRecorderCapacity(t *testing.T) {
+	r := &mail.MemRecorder{Capacity: 2}
+
+	for _, topic := range []string{"one", "two", "three"} {
+		if err := r.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: topic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if r.Len() != 2 {
+		t.Fatalf("expected 2 retained mails, got %v", r.Len())
+	}
+
+	if ok, _ := r.Seen(mail.Mail{From: "test@example.de", To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "one"}}); ok {
+		t.Error("expected the oldest mail to be evicted")
+	}
+
+	if got := r.FindBySubject("t"); len(got) != 2 || got[0].Message.Topic != "two" || got[1].Message.Topic != "three" {
+		t.Errorf("expected the two most recent mails, got %+v", got)
+	}
+}
@@ -1,7 +1,32 @@
 package mail_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	stdmail "net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/f9a/mail"
 )
@@ -12,13 +37,11 @@ type testData struct {
 }
 
 func TestMail(t *testing.T) {
-	m, err := mail.Dial(mail.TxConfig{
-		User:     "test@example.de",
-		Password: "xxx",
-		Host:     "smtp.example.de",
-		Port:     38145,
-		TmpDir:   "/tmp",
-	})
+	server := newSMTPServer(t, nil)
+
+	cfg := server.Config()
+	cfg.TmpDir = "/tmp"
+	m, err := mail.Dial(cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -43,3 +66,2199 @@ func TestMail(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// blackholeServer accepts connections but never responds
+func blackholeServer(t *testing.T) (host string, port int) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conns []net.Conn
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	t.Cleanup(func() {
+		l.Close()
+		<-done
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestSendContextDeadline(t *testing.T) {
+	host, port := blackholeServer(t)
+
+	m, err := mail.Dial(mail.TxConfig{
+		User:     "test@example.de",
+		Password: "xxx",
+		Host:     host,
+		Port:     port,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = m.SendContext(ctx, "test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected send to return promptly, took %v", elapsed)
+	}
+}
+
+type smtpEnvelope struct {
+	From string
+	To   []string
+	Data string
+}
+
+// smtpServer is a minimal smtp server recording received messages
+type smtpServer struct {
+	Host string
+	Port int
+
+	// replies overrides the reply for a command, e.g. "RCPT": "550 no such user"
+	replies map[string]string
+
+	mu          sync.Mutex
+	envelopes   []smtpEnvelope
+	connections int
+	// queued replies are used once for a command before replies
+	queued map[string][]string
+	// commands are all received command lines
+	commands []string
+}
+
+// queueReplies uses replies once each for the next cmds
+func (s *smtpServer) queueReplies(cmd string, replies ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.queued == nil {
+		s.queued = map[string][]string{}
+	}
+	s.queued[cmd] = append(s.queued[cmd], replies...)
+}
+
+// nextQueued returns the next queued reply for cmd
+func (s *smtpServer) nextQueued(cmd string) (reply string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queued[cmd]) == 0 {
+		return
+	}
+
+	reply = s.queued[cmd][0]
+	s.queued[cmd] = s.queued[cmd][1:]
+
+	return reply, true
+}
+
+func newSMTPServer(t *testing.T, replies map[string]string) *smtpServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return startSMTPServer(t, l, replies)
+}
+
+// newTLSSMTPServer starts a smtp server expecting an implicit tls connection
+func newTLSSMTPServer(t *testing.T, replies map[string]string) *smtpServer {
+	t.Helper()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{selfSignedCertificate(t)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return startSMTPServer(t, l, replies)
+}
+
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func startSMTPServer(t *testing.T, l net.Listener, replies map[string]string) *smtpServer {
+	t.Helper()
+
+	addr := l.Addr().(*net.TCPAddr)
+	s := &smtpServer{Host: addr.IP.String(), Port: addr.Port, replies: replies}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	t.Cleanup(func() {
+		l.Close()
+		wg.Wait()
+	})
+
+	return s
+}
+
+func (s *smtpServer) reply(conn *textproto.Conn, cmd, fallback string) error {
+	if r, ok := s.replies[cmd]; ok {
+		return conn.PrintfLine("%s", r)
+	}
+
+	return conn.PrintfLine("%s", fallback)
+}
+
+func (s *smtpServer) serve(c net.Conn) {
+	defer c.Close()
+
+	s.mu.Lock()
+	s.connections++
+	s.mu.Unlock()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn := textproto.NewConn(c)
+	if err := conn.PrintfLine("220 localhost ESMTP"); err != nil {
+		return
+	}
+
+	var envelope smtpEnvelope
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		if r, ok := s.nextQueued(cmd); ok {
+			if err = conn.PrintfLine("%s", r); err != nil {
+				return
+			}
+			continue
+		}
+
+		switch cmd {
+		case "EHLO", "HELO":
+			err = s.reply(conn, cmd, "250 localhost")
+		case "AUTH":
+			err = s.reply(conn, cmd, "235 authenticated")
+		case "MAIL":
+			envelope = smtpEnvelope{From: smtpPath(line)}
+			err = s.reply(conn, cmd, "250 OK")
+		case "RCPT":
+			if r, ok := s.replies[cmd]; ok {
+				err = conn.PrintfLine("%s", r)
+				break
+			}
+			envelope.To = append(envelope.To, smtpPath(line))
+			err = conn.PrintfLine("250 OK")
+		case "DATA":
+			if r, ok := s.replies[cmd]; ok {
+				err = conn.PrintfLine("%s", r)
+				break
+			}
+			if err = conn.PrintfLine("354 go ahead"); err != nil {
+				return
+			}
+
+			var data []byte
+			data, err = conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			envelope.Data = string(data)
+
+			s.mu.Lock()
+			s.envelopes = append(s.envelopes, envelope)
+			s.mu.Unlock()
+
+			err = conn.PrintfLine("250 OK")
+		case "QUIT":
+			conn.PrintfLine("221 bye")
+			return
+		default:
+			err = s.reply(conn, cmd, "250 OK")
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func smtpPath(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+
+	return line[start+1 : end]
+}
+
+// Envelopes returns all received messages
+func (s *smtpServer) Envelopes() []smtpEnvelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]smtpEnvelope(nil), s.envelopes...)
+}
+
+// Commands returns all received command lines
+func (s *smtpServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+// Connections returns the number of accepted connections
+func (s *smtpServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connections
+}
+
+func (s *smtpServer) Config() mail.TxConfig {
+	return mail.TxConfig{
+		User:     "test@example.de",
+		Password: "xxx",
+		Host:     s.Host,
+		Port:     s.Port,
+	}
+}
+
+func TestSendAlternatives(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{
+		Topic:       "topic",
+		Body:        "Hi",
+		ContentType: "text/plain",
+		Alternatives: []mail.Alternative{
+			{ContentType: "text/html", Body: "<p>Hi</p>"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 1 {
+		t.Fatalf("expected one message, got %v", len(envelopes))
+	}
+
+	data := envelopes[0].Data
+	for _, want := range []string{"multipart/alternative", "text/plain", "text/html", "<p>Hi</p>"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("expected %q in message:\n%s", want, data)
+		}
+	}
+}
+
+func TestSendContextReturnsSendError(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"RCPT": "550 no such user"})
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.SendContext(context.Background(), "test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if err == nil || !strings.Contains(err.Error(), "no such user") {
+		t.Fatalf("expected rejected recipient error, got: %v", err)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	host, port := blackholeServer(t)
+
+	m, err := mail.Dial(mail.TxConfig{
+		User:     "test@example.de",
+		Password: "xxx",
+		Host:     host,
+		Port:     port,
+		Timeout:  100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected timeout to fire, send took %v", elapsed)
+	}
+}
+
+func TestTxConfigValidateTimeout(t *testing.T) {
+	cfg := mail.TxConfig{
+		User:     "test@example.de",
+		Password: "xxx",
+		Host:     "smtp.example.de",
+		Port:     587,
+		Timeout:  -time.Second,
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected negative timeout to be invalid")
+	}
+}
+
+func TestSendEncryption(t *testing.T) {
+	t.Run("ssl", func(t *testing.T) {
+		server := newTLSSMTPServer(t, nil)
+
+		cfg := server.Config()
+		cfg.Encryption = mail.EncryptionSSL
+
+		m, err := mail.Dial(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+		if err == nil {
+			t.Fatal("expected self-signed certificate to be rejected")
+		}
+
+		cfg.InsecureSkipVerify = true
+		m.UpdateTxConfig(cfg)
+
+		err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(server.Envelopes()) != 1 {
+			t.Fatalf("expected one message, got %v", len(server.Envelopes()))
+		}
+	})
+
+	t.Run("mandatory starttls", func(t *testing.T) {
+		server := newSMTPServer(t, nil)
+
+		cfg := server.Config()
+		cfg.Encryption = mail.EncryptionSTARTTLS
+
+		m, err := mail.Dial(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+		if err == nil {
+			t.Fatal("expected error for server without starttls")
+		}
+
+		if len(server.Envelopes()) != 0 {
+			t.Fatal("expected no message to be sent unencrypted")
+		}
+	})
+}
+
+func TestTxConfigValidateEncryption(t *testing.T) {
+	tests := []struct {
+		name       string
+		port       int
+		encryption mail.Encryption
+		wantErr    bool
+	}{
+		{name: "default", port: 587},
+		{name: "ssl on 465", port: 465, encryption: mail.EncryptionSSL},
+		{name: "starttls on 587", port: 587, encryption: mail.EncryptionSTARTTLS},
+		{name: "none on 25", port: 25, encryption: mail.EncryptionNone},
+		{name: "ssl on 587", port: 587, encryption: mail.EncryptionSSL, wantErr: true},
+		{name: "starttls on 465", port: 465, encryption: mail.EncryptionSTARTTLS, wantErr: true},
+		{name: "unknown", port: 587, encryption: "tls", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mail.TxConfig{
+				User:       "test@example.de",
+				Password:   "xxx",
+				Host:       "smtp.example.de",
+				Port:       tt.port,
+				Encryption: tt.encryption,
+			}
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// sendToServer sends a message to a fake smtp server and returns the received data
+func sendToServer(t *testing.T, to mail.To, message mail.Message, options ...mail.SendOption) string {
+	t.Helper()
+
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", to, message, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 1 {
+		t.Fatalf("expected one message, got %v", len(envelopes))
+	}
+
+	return envelopes[0].Data
+}
+
+func TestReplyTo(t *testing.T) {
+	data := sendToServer(t, mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.ReplyTo("support@example.de", "", "help@example.de"),
+	)
+
+	want := "Reply-To: support@example.de, help@example.de\n"
+	if !strings.Contains(data, want) {
+		t.Errorf("expected %q in message:\n%s", want, data)
+	}
+
+	data = sendToServer(t, mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}, mail.ReplyTo())
+	if strings.Contains(data, "Reply-To") {
+		t.Errorf("expected no Reply-To header in message:\n%s", data)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	data := sendToServer(t, mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.Header("x-campaign-id", "42"),
+		mail.Headers(map[string]string{
+			"Date":    "Mon, 02 Jan 2006 15:04:05 +0000",
+			"subject": "overridden",
+			"From":    "evil@example.de",
+		}),
+	)
+
+	for _, want := range []string{
+		"X-Campaign-Id: 42\n",
+		"Date: Mon, 02 Jan 2006 15:04:05 +0000\n",
+		"From: test@example.de\n",
+		"Subject: topic\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("expected %q in message:\n%s", want, data)
+		}
+	}
+
+	for _, notWant := range []string{"overridden", "evil@example.de"} {
+		if strings.Contains(data, notWant) {
+			t.Errorf("didn't expect %q in message:\n%s", notWant, data)
+		}
+	}
+}
+
+func TestCcBcc(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.Cc("ben@example.de"),
+		mail.Bcc("cleo@example.de"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := server.Envelopes()[0]
+	wantTo := []string{"ava@example.de", "ben@example.de", "cleo@example.de"}
+	if strings.Join(envelope.To, ",") != strings.Join(wantTo, ",") {
+		t.Errorf("expected recipients %v, got %v", wantTo, envelope.To)
+	}
+
+	for _, want := range []string{"To: ava@example.de\n", "Cc: ben@example.de\n"} {
+		if !strings.Contains(envelope.Data, want) {
+			t.Errorf("expected %q in message:\n%s", want, envelope.Data)
+		}
+	}
+
+	if strings.Contains(envelope.Data, "cleo@example.de") {
+		t.Errorf("expected bcc recipient to be hidden:\n%s", envelope.Data)
+	}
+}
+
+func TestAsCc(t *testing.T) {
+	data := sendToServer(t, mail.To{"ava@example.de", "ben@example.de"}, mail.Message{Topic: "topic"}, mail.AsCc())
+
+	for _, want := range []string{"To: ava@example.de\n", "Cc: ben@example.de\n"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("expected %q in message:\n%s", want, data)
+		}
+	}
+}
+
+func TestSendValidatesAddresses(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de", "not-an-address"}, mail.Message{Topic: "topic"},
+		mail.Cc("ben@"),
+	)
+	if err == nil {
+		t.Fatal("expected error for invalid addresses")
+	}
+
+	for _, want := range []string{`to "not-an-address"`, `cc "ben@"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error: %v", want, err)
+		}
+	}
+
+	if len(server.Envelopes()) != 0 {
+		t.Fatal("expected no message to be sent")
+	}
+
+	err = m.Send("test@example.de", mail.To{"not-an-address"}, mail.Message{Topic: "topic"}, mail.SkipAddressValidation())
+	if err != nil && strings.Contains(err.Error(), "invalid email-addresses") {
+		t.Fatalf("expected validation to be skipped, got: %v", err)
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		name, email string
+	}{
+		{"Acme Support", "support@acme.com"},
+		{"Jürgen Müller", "mueller@example.de"},
+		{"", "ava@example.de"},
+	}
+
+	for _, tt := range tests {
+		addr := mail.Address(tt.name, tt.email)
+		for _, r := range addr {
+			if r > 127 {
+				t.Errorf("expected %q to be ASCII encoded", addr)
+				break
+			}
+		}
+
+		parsed, err := stdmail.ParseAddress(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.Name != tt.name || parsed.Address != tt.email {
+			t.Errorf("expected %q <%s>, got %q <%s>", tt.name, tt.email, parsed.Name, parsed.Address)
+		}
+	}
+}
+
+func TestCcDisplayNames(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.Cc(mail.Address("Jürgen Müller", "mueller@example.de"), "ben@example.de", "Carl <carl@example.de>"),
+		mail.Bcc(mail.Address("Dörte", "doerte@example.de")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := server.Envelopes()[0]
+	if got := strings.Join(envelope.To, ","); got != "ava@example.de,mueller@example.de,ben@example.de,carl@example.de,doerte@example.de" {
+		t.Errorf("unexpected recipients %v", got)
+	}
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(envelope.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := msg.Header.Get("Cc")
+	if strings.Contains(raw, "ü") {
+		t.Errorf("expected display name encoded as defined in RFC 2047, got %q", raw)
+	}
+
+	cc, err := msg.Header.AddressList("Cc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []stdmail.Address{
+		{Name: "Jürgen Müller", Address: "mueller@example.de"},
+		{Address: "ben@example.de"},
+		{Name: "Carl", Address: "carl@example.de"},
+	}
+	if len(cc) != len(want) {
+		t.Fatalf("expected %v cc addresses, got %v", len(want), cc)
+	}
+	for i, addr := range cc {
+		if *addr != want[i] {
+			t.Errorf("expected %v, got %v", want[i], addr)
+		}
+	}
+
+	first, err := stdmail.ParseAddress(strings.Split(raw, ", ")[0])
+	if err != nil || first.Name != "Jürgen Müller" {
+		t.Errorf("expected unicode display name to round-trip, got %v: %v", first, err)
+	}
+
+	if msg.Header.Get("Bcc") != "" {
+		t.Error("expected no Bcc header")
+	}
+}
+
+func TestSendDisplayNames(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("Acme Support <support@acme.com>", mail.To{"Jürgen Müller <mueller@example.de>"}, mail.Message{Topic: "topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := server.Envelopes()[0]
+	if envelope.From != "support@acme.com" {
+		t.Errorf("expected envelope sender support@acme.com, got %v", envelope.From)
+	}
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(envelope.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to, err := msg.Header.AddressList("To")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(to) != 1 || to[0].Name != "Jürgen Müller" || to[0].Address != "mueller@example.de" {
+		t.Errorf("unexpected To header: %v", msg.Header.Get("To"))
+	}
+}
+
+func TestSendFromDisplayNameWithLogin(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"EHLO": "250-localhost\r\n250 AUTH PLAIN"})
+
+	cfg := server.Config()
+	cfg.User = "noreply@acme.com"
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("Acme Billing <billing@acme.com>", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := ""
+	for _, cmd := range server.Commands() {
+		if strings.HasPrefix(cmd, "AUTH PLAIN ") {
+			auth = cmd
+		}
+	}
+
+	credentials, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "AUTH PLAIN "))
+	if err != nil || string(credentials) != "\x00noreply@acme.com\x00xxx" {
+		t.Errorf("expected authentication as noreply@acme.com, got %q", credentials)
+	}
+
+	envelope := server.Envelopes()[0]
+	if envelope.From != "noreply@acme.com" {
+		t.Errorf("expected login as envelope sender, got %v", envelope.From)
+	}
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(envelope.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := msg.Header.Get("From"); got != `"Acme Billing" <billing@acme.com>` {
+		t.Errorf("unexpected From header %q", got)
+	}
+
+	err = m.Send("Acme Billing <billing@acme.com>", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}, mail.ReturnPath("bounces@acme.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if envelope = server.Envelopes()[1]; envelope.From != "bounces@acme.com" {
+		t.Errorf("expected return-path as envelope sender, got %v", envelope.From)
+	}
+}
+
+func TestSendMessageID(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.SendContext(context.Background(), "test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.de>") {
+		t.Errorf("expected generated Message-ID with the from domain, got %v", id)
+	}
+
+	id2, err := m.SendContext(context.Background(), "test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.Header("Message-ID", "<custom@example.de>"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id2 != "<custom@example.de>" {
+		t.Errorf("expected custom Message-ID, got %v", id2)
+	}
+
+	envelopes := server.Envelopes()
+	for i, want := range []string{id, id2} {
+		if strings.Count(envelopes[i].Data, want) != 1 {
+			t.Errorf("expected Message-ID %v once in message:\n%s", want, envelopes[i].Data)
+		}
+	}
+}
+
+func TestMessageIDDomain(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	cfg := server.Config()
+	cfg.MessageIDDomain = "mail.acme.com"
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.SendContext(context.Background(), "Acme <billing@acme.com>", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(id, "@mail.acme.com>") {
+		t.Errorf("expected Message-ID with configured domain, got %v", id)
+	}
+
+	if !strings.Contains(server.Envelopes()[0].Data, "Message-Id: "+id) {
+		t.Errorf("expected Message-ID %v in message:\n%s", id, server.Envelopes()[0].Data)
+	}
+
+	r := &mail.MemRecorder{}
+	r.UpdateTxConfig(mail.TxConfig{Host: "smtp.example.de"})
+	if id, _ = r.SendContext(context.Background(), "invalid", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}); !strings.HasSuffix(id, "@smtp.example.de>") {
+		t.Errorf("expected Message-ID with host as domain for from without domain, got %v", id)
+	}
+
+	cfg.MessageIDDomain = "not a domain"
+	if err = cfg.Validate(); err == nil {
+		t.Error("expected invalid message id domain")
+	}
+}
+
+func TestSendAttachmentsFromMemory(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	cfg := server.Config()
+	cfg.TmpDir = filepath.Join(t.TempDir(), "missing")
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected missing TmpDir to be valid, got: %v", err)
+	}
+
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{
+		Topic:       "topic",
+		ContentType: "text/plain",
+		Attachments: []mail.Attachment{
+			{Name: "logo", Kind: "image/png", Content: pngContent},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(server.Envelopes()[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var found bool
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if part.FileName() != "logo.png" {
+			continue
+		}
+		found = true
+
+		if kind := part.Header.Get("Content-Type"); !strings.HasPrefix(kind, "image/png") {
+			t.Errorf("expected content-type image/png, got %v", kind)
+		}
+
+		content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(content, pngContent) {
+			t.Errorf("expected attachment content %q, got %q", pngContent, content)
+		}
+	}
+
+	if !found {
+		t.Fatal("expected logo.png attachment")
+	}
+}
+
+func TestSendReturnsTransmissionError(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"DATA": "554 transaction failed"})
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{
+		Topic:       "topic",
+		Attachments: []mail.Attachment{{Name: "logo", Kind: "image/png", Content: pngContent}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "transaction failed") {
+		t.Fatalf("expected send error to propagate, got: %v", err)
+	}
+}
+
+func TestSendMany(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.SendMany("test@example.de", []mail.Outgoing{
+		{To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "one"}},
+		{To: mail.To{"ben@example.de"}, Message: mail.Message{Topic: "two"}, Options: []mail.SendOption{mail.Cc("cleo@example.de")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(server.Envelopes()); n != 2 {
+		t.Errorf("expected 2 messages, got %v", n)
+	}
+
+	if n := server.Connections(); n != 1 {
+		t.Errorf("expected one connection, got %v", n)
+	}
+}
+
+func TestOutgoingJSON(t *testing.T) {
+	date := time.Date(2024, time.March, 4, 9, 30, 0, 0, time.UTC)
+	outgoing := mail.Outgoing{
+		From:    "test@example.de",
+		To:      mail.To{" ava@EXAMPLE.de "},
+		Message: mail.Message{Topic: "topic", Body: "body", ContentType: "text/plain"},
+		Options: []mail.SendOption{
+			mail.NormalizeRecipients(),
+			mail.Cc("ben@example.de", "ava@example.de"),
+			mail.Bcc("carl@example.de"),
+			mail.ReplyTo("support@example.de"),
+			mail.WithPriority(mail.PriorityHigh),
+			mail.Date(date),
+		},
+	}
+
+	data, err := json.Marshal(outgoing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored mail.Outgoing
+	if err = json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newSMTPServer(t, nil)
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Send(stored.From, stored.To, stored.Message, stored.Options...); err != nil {
+		t.Fatal(err)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 1 {
+		t.Fatalf("expected one message, got %v", len(envelopes))
+	}
+
+	if got := strings.Join(envelopes[0].To, ","); got != "ava@example.de,ben@example.de,carl@example.de" {
+		t.Errorf("unexpected recipients %v", got)
+	}
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(envelopes[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{
+		"From":       "test@example.de",
+		"Cc":         "ben@example.de",
+		"Bcc":        "",
+		"Reply-To":   "support@example.de",
+		"Importance": "high",
+		"Date":       date.Format(time.RFC1123Z),
+	} {
+		if got := msg.Header.Get(key); got != want {
+			t.Errorf("expected %v %q, got %q", key, want, got)
+		}
+	}
+
+	outgoing.Options = []mail.SendOption{mail.ReturnPath("invalid")}
+	if _, err = json.Marshal(outgoing); err == nil {
+		t.Error("expected error for invalid option")
+	}
+}
+
+func TestReuseConnection(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	cfg := server.Config()
+	cfg.ReuseConnection = true
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	send := func() {
+		t.Helper()
+		if err := m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send()
+	send()
+	if n := server.Connections(); n != 1 {
+		t.Errorf("expected sends to share one connection, got %v", n)
+	}
+
+	m.UpdateTxConfig(cfg)
+	send()
+	if n := server.Connections(); n != 2 {
+		t.Errorf("expected new connection after config update, got %v", n)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	send()
+	if n := server.Connections(); n != 3 {
+		t.Errorf("expected new connection after close, got %v", n)
+	}
+
+	if n := len(server.Envelopes()); n != 4 {
+		t.Errorf("expected 4 messages, got %v", n)
+	}
+}
+
+func TestSendBatch(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := m.SendBatch(context.Background(), "test@example.de", []mail.BatchItem{
+		{To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "one"}},
+		{To: mail.To{"invalid"}, Message: mail.Message{Topic: "two"}},
+		{To: mail.To{"ben@example.de"}, Message: mail.Message{Topic: "three"}},
+	})
+
+	if len(errs) != 3 || errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("expected only the second item to fail, got %v", errs)
+	}
+
+	if n := len(server.Envelopes()); n != 2 {
+		t.Errorf("expected 2 messages, got %v", n)
+	}
+
+	if n := server.Connections(); n != 1 {
+		t.Errorf("expected one connection, got %v", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs = m.SendBatch(ctx, "test@example.de", []mail.BatchItem{
+		{To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "one"}},
+	})
+	if !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("expected canceled error, got %v", errs[0])
+	}
+}
+
+func TestSendBatchRejectedRecipient(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"RCPT": "550 no such user"})
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := m.SendBatch(context.Background(), "test@example.de", []mail.BatchItem{
+		{To: mail.To{"ava@example.de"}, Message: mail.Message{Topic: "one"}},
+		{To: mail.To{"ben@example.de"}, Message: mail.Message{Topic: "two"}},
+	})
+
+	for i, err := range errs {
+		if err == nil || !strings.Contains(err.Error(), "no such user") {
+			t.Errorf("expected rejected recipient for item %d, got %v", i, err)
+		}
+	}
+
+	if n := server.Connections(); n != 1 {
+		t.Errorf("expected rejected recipients to keep the connection, got %v connections", n)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	server := newSMTPServer(t, nil)
+	server.queueReplies("MAIL", "451 try again later", "421 service not available")
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.Retry(2, time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(server.Envelopes()); n != 1 {
+		t.Errorf("expected one message, got %v", n)
+	}
+
+	server.queueReplies("MAIL", "451 try again later")
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if err == nil {
+		t.Error("expected error without retry")
+	}
+
+	server.queueReplies("MAIL", "550 mailbox unavailable")
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.Retry(2, time.Millisecond),
+	)
+	if err == nil || !strings.Contains(err.Error(), "mailbox unavailable") {
+		t.Errorf("expected permanent error not to be retried, got: %v", err)
+	}
+
+	if n := len(server.Envelopes()); n != 1 {
+		t.Errorf("expected no further message, got %v", n)
+	}
+}
+
+func TestRetryRespectsContext(t *testing.T) {
+	server := newSMTPServer(t, nil)
+	server.queueReplies("MAIL", "451 try again later")
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = m.SendContext(ctx, "test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.Retry(1, time.Minute),
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded while waiting for retry, got: %v", err)
+	}
+}
+
+func TestSendValidateMessage(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken := mail.Message{Body: "Hi", ContentType: "text/plain"}
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, broken, mail.ValidateMessage())
+	if err == nil || !strings.Contains(err.Error(), "invalid message") {
+		t.Fatalf("expected invalid message error, got: %v", err)
+	}
+
+	if len(server.Envelopes()) != 0 {
+		t.Fatal("expected no message to be sent")
+	}
+
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, broken); err != nil {
+		t.Fatalf("expected message to be sent without ValidateMessage, got: %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	cfg := server.Config()
+	cfg.DryRun = true
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := mail.Message{Topic: "topic", Body: "Hi", ContentType: "text/plain"}
+	id, err := m.SendContext(context.Background(), "test@example.de", mail.To{"ava@example.de"}, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" {
+		t.Error("expected message id in dry run")
+	}
+
+	errs := m.SendBatch(context.Background(), "test@example.de", []mail.BatchItem{
+		{To: mail.To{"ava@example.de"}, Message: message},
+		{To: mail.To{"not-an-address"}, Message: message},
+	})
+	if errs[0] != nil || errs[1] == nil {
+		t.Errorf("expected only invalid item to fail, got: %v", errs)
+	}
+
+	if len(server.Envelopes()) != 0 || server.Connections() != 0 {
+		t.Errorf("expected no connection in dry run, got %d", server.Connections())
+	}
+}
+
+func TestOnSend(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var infos []mail.SendInfo
+	var errs []error
+	m.OnSend = func(info mail.SendInfo, err error) {
+		infos = append(infos, info)
+		errs = append(errs, err)
+	}
+
+	message := mail.Message{
+		Topic:       "topic",
+		Body:        "Hi",
+		ContentType: "text/plain",
+		Attachments: []mail.Attachment{{Name: "logo", Kind: "image/png", Content: pngContent}},
+	}
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, message, mail.Cc("ben@example.de"), mail.Bcc("cleo@example.de"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = m.Send("test@example.de", mail.To{"not-an-address"}, message)
+
+	m.SendBatch(context.Background(), "test@example.de", []mail.BatchItem{{To: mail.To{"ava@example.de"}, Message: message}})
+
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 calls, got %d", len(infos))
+	}
+
+	info := infos[0]
+	if errs[0] != nil || info.From != "test@example.de" || info.Subject != "topic" || info.Recipients != 3 ||
+		info.Attachments != 1 || info.Size != len("Hi")+len(pngContent) || info.MessageID == "" || info.Elapsed <= 0 {
+		t.Errorf("unexpected send info: %+v, %v", info, errs[0])
+	}
+
+	if errs[1] == nil {
+		t.Error("expected error of failed send")
+	}
+
+	if errs[2] != nil || infos[2].MessageID == "" {
+		t.Errorf("unexpected batch send info: %+v, %v", infos[2], errs[2])
+	}
+}
+
+func TestTxConfigValidateAuthentication(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     mail.TxConfig
+		wantErr bool
+	}{
+		{name: "authenticated", cfg: mail.TxConfig{User: "test@example.de", Password: "xxx", Host: "smtp.example.de"}},
+		{name: "missing credentials", cfg: mail.TxConfig{Host: "smtp.example.de"}, wantErr: true},
+		{name: "missing password", cfg: mail.TxConfig{User: "test@example.de", Host: "smtp.example.de"}, wantErr: true},
+		{name: "unauthenticated", cfg: mail.TxConfig{Host: "relay.example.de", Port: 25, AllowUnauthenticated: true}},
+		{name: "unauthenticated without host", cfg: mail.TxConfig{AllowUnauthenticated: true}, wantErr: true},
+		{name: "ssl on default port", cfg: mail.TxConfig{Host: "relay.example.de", AllowUnauthenticated: true, Encryption: mail.EncryptionSSL}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSendUnauthenticated(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"EHLO": "250-localhost\r\n250 AUTH PLAIN"})
+
+	send := func(cfg mail.TxConfig) {
+		t.Helper()
+
+		m, err := mail.Dial(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(server.Config())
+
+	cfg := server.Config()
+	cfg.AllowUnauthenticated = true
+	send(cfg)
+
+	auths := 0
+	for _, cmd := range server.Commands() {
+		if strings.HasPrefix(cmd, "AUTH") {
+			auths++
+		}
+	}
+
+	if auths != 1 || len(server.Envelopes()) != 2 {
+		t.Errorf("expected only the authenticated send to authenticate, got %d auths: %v", auths, server.Commands())
+	}
+}
+
+func TestSendXOAuth2(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"EHLO": "250-localhost\r\n250 AUTH XOAUTH2 PLAIN"})
+
+	tokens := 0
+	cfg := server.Config()
+	cfg.Password = ""
+	cfg.TokenSource = func(ctx context.Context) (string, error) {
+		tokens++
+		return fmt.Sprintf("token-%d", tokens), nil
+	}
+
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var auths []string
+	for _, cmd := range server.Commands() {
+		if strings.HasPrefix(cmd, "AUTH ") {
+			auths = append(auths, cmd)
+		}
+	}
+
+	if len(auths) != 2 {
+		t.Fatalf("expected an AUTH for every connection, got: %v", auths)
+	}
+
+	for i, cmd := range auths {
+		fields := strings.Fields(cmd)
+		if len(fields) != 3 || fields[1] != "XOAUTH2" {
+			t.Fatalf("unexpected auth command: %v", cmd)
+		}
+
+		sasl, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := fmt.Sprintf("user=test@example.de\x01auth=Bearer token-%d\x01\x01", i+1)
+		if string(sasl) != want {
+			t.Errorf("expected sasl %q, got %q", want, sasl)
+		}
+	}
+
+	cfg.TokenSource = func(ctx context.Context) (string, error) { return "", errors.New("expired") }
+	m.UpdateTxConfig(cfg)
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected error of token source, got: %v", err)
+	}
+}
+
+func TestLocalName(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	cfg := server.Config()
+	cfg.LocalName = "mail.example.de"
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if commands := server.Commands(); len(commands) == 0 || commands[0] != "EHLO mail.example.de" {
+		t.Errorf("expected EHLO with local name, got: %v", commands)
+	}
+
+	for name, valid := range map[string]bool{
+		"mail.example.de": true,
+		"localhost":       true,
+		"[192.0.2.1]":     true,
+		"not a host":      false,
+		"-mail.de":        false,
+		"mail..de":        false,
+	} {
+		cfg.LocalName = name
+		if err := cfg.Validate(); (err == nil) != valid {
+			t.Errorf("%q: expected valid %v, got: %v", name, valid, err)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"EHLO": "250-localhost\r\n250 AUTH PLAIN"})
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Connections() != 1 || len(server.Envelopes()) != 0 {
+		t.Errorf("expected one connection without message, got %d", server.Connections())
+	}
+
+	rejecting := newSMTPServer(t, map[string]string{"EHLO": "250-localhost\r\n250 AUTH PLAIN", "AUTH": "535 invalid credentials"})
+	m.UpdateTxConfig(rejecting.Config())
+	if err = m.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid credentials") {
+		t.Errorf("expected auth error, got: %v", err)
+	}
+
+	cfg := server.Config()
+	cfg.Host, cfg.Port = blackholeServer(t)
+	m.UpdateTxConfig(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err = m.Ping(ctx); err == nil {
+		t.Error("expected error for server without greeting")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected ping to stop with the context, took %v", elapsed)
+	}
+
+	if err = mail.New().Ping(context.Background()); err == nil {
+		t.Error("expected error of unconfigured transmitter")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RateLimit(20, 2)
+
+	message := mail.Message{Topic: "topic"}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the burst of 2 is sent at once, the 2 further sends wait 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected sends to be throttled, took %v", elapsed)
+	}
+
+	m.RateLimit(0.1, 1)
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err = m.SendContext(ctx, "test@example.de", mail.To{"ava@example.de"}, message); err == nil {
+		t.Error("expected error when the context ends before the rate limit allows to send")
+	}
+
+	m.RateLimit(0, 0)
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected no limit after removing it, took %v", elapsed)
+	}
+
+	if n := len(server.Envelopes()); n != 8 {
+		t.Errorf("expected 8 messages, got %d", n)
+	}
+}
+
+func TestSendWritesNoTmpFiles(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	cfg := server.Config()
+	cfg.TmpDir = t.TempDir()
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{
+		Topic:       "topic",
+		ContentType: "text/plain",
+		Attachments: []mail.Attachment{
+			{Name: "logo", Kind: "image/png", Content: pngContent},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(cfg.TmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("expected no files in TmpDir, got %v", entries)
+	}
+}
+
+func TestDate(t *testing.T) {
+	date := time.Date(2024, time.March, 4, 9, 30, 0, 0, time.UTC)
+	data := sendToServer(t, mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}, mail.Date(date))
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := msg.Header.Date()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.Equal(date) {
+		t.Errorf("expected Date %v, got %v", date, got)
+	}
+
+	data = sendToServer(t, mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	msg, err = stdmail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = msg.Header.Date()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if time.Since(got) > time.Minute {
+		t.Errorf("expected Date of now, got %v", got)
+	}
+}
+
+func TestReturnPath(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("Acme Support <support@acme.com>", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+		mail.ReturnPath("Bounces <bounces@acme.com>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := server.Envelopes()[0]
+	if envelope.From != "bounces@acme.com" {
+		t.Errorf("expected envelope sender bounces@acme.com, got %v", envelope.From)
+	}
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(envelope.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := msg.Header.Get("Return-Path"); got != "<bounces@acme.com>" {
+		t.Errorf("expected Return-Path <bounces@acme.com>, got %q", got)
+	}
+
+	from, err := msg.Header.AddressList("From")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(from) != 1 || from[0].Address != "support@acme.com" {
+		t.Errorf("expected visible From support@acme.com, got %v", from)
+	}
+
+	err = m.Send("support@acme.com", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}, mail.ReturnPath("bounces"))
+	if err == nil || !strings.Contains(err.Error(), "return-path") {
+		t.Errorf("expected invalid return-path error, got %v", err)
+	}
+}
+
+func TestSendMerge(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := mail.NewTemplate("News", "Hello {{.Name}}", mail.StrictTemplates())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := m.SendMerge(context.Background(), "test@example.de", tpl, []mail.MergeRecipient{
+		{Address: "ava@example.de", Data: map[string]string{"Name": "Ava"}, Options: []mail.SendOption{
+			mail.Unsubscribe("mailto:unsubscribe+ava@example.de", ""),
+		}},
+		{Address: "missing@example.de", Data: map[string]string{}},
+		{Address: "ben@example.de", Data: map[string]string{"Name": "Ben"}},
+	})
+
+	if len(errs) != 3 || errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("expected only the second recipient to fail, got %v", errs)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 2 {
+		t.Fatalf("expected 2 messages, got %v", len(envelopes))
+	}
+
+	for i, want := range []string{"Hello Ava", "Hello Ben"} {
+		if !strings.Contains(envelopes[i].Data, want) {
+			t.Errorf("expected %q in message:\n%s", want, envelopes[i].Data)
+		}
+	}
+
+	if !strings.Contains(envelopes[0].Data, "unsubscribe+ava@example.de") || strings.Contains(envelopes[1].Data, "List-Unsubscribe") {
+		t.Error("expected the unsubscribe header only in the first message")
+	}
+
+	if n := server.Connections(); n != 1 {
+		t.Errorf("expected one connection, got %v", n)
+	}
+}
+
+func TestSendRoles(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := mail.NewTemplate("Incident", "{{if .Name}}Hello {{.Name}}, please fix it{{else}}FYI{{end}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := m.SendRoles(context.Background(), "test@example.de", tpl, []mail.RoleRecipient{
+		{Address: "Ava <ava@example.de>", Role: mail.RoleTo, Data: map[string]string{"Name": "Ava"}},
+		{Address: "manager@example.de", Role: mail.RoleCc},
+		{Address: "audit@example.de", Role: mail.RoleBcc},
+		{Address: "other@example.de", Role: "reply-to"},
+	})
+
+	if len(results) != 4 || results[0].Err != nil || results[1].Err != nil || results[2].Err != nil || results[3].Err == nil {
+		t.Fatalf("expected only the recipient with unknown role to fail, got %+v", results)
+	}
+
+	if results[0].Message.Body != "Hello Ava, please fix it" || results[1].Message.Body != "FYI" || results[1].Recipient.Address != "manager@example.de" {
+		t.Errorf("unexpected rendered messages %+v", results)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 3 {
+		t.Fatalf("expected 3 messages, got %v", len(envelopes))
+	}
+
+	for i, want := range []struct{ to, body string }{
+		{"ava@example.de", "Hello Ava"},
+		{"manager@example.de", "FYI"},
+		{"audit@example.de", "FYI"},
+	} {
+		if len(envelopes[i].To) != 1 || envelopes[i].To[0] != want.to {
+			t.Errorf("expected copy %d only delivered to %v, got %v", i+1, want.to, envelopes[i].To)
+		}
+
+		msg, err := stdmail.ReadMessage(strings.NewReader(envelopes[i].Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.Header.Get("To") != `"Ava" <ava@example.de>` || msg.Header.Get("Cc") != "manager@example.de" || msg.Header.Get("Bcc") != "" {
+			t.Errorf("unexpected headers of copy %d: %v", i+1, msg.Header)
+		}
+
+		if !strings.Contains(envelopes[i].Data, want.body) {
+			t.Errorf("expected %q in copy %d:\n%s", want.body, i+1, envelopes[i].Data)
+		}
+	}
+
+	if n := server.Connections(); n != 1 {
+		t.Errorf("expected one connection, got %v", n)
+	}
+}
+
+func TestSendRolesBcc(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := mail.NewTemplate("Newsletter", "News")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := m.SendRoles(context.Background(), "test@example.de", tpl, []mail.RoleRecipient{
+		{Address: "ava@example.de", Role: mail.RoleBcc},
+		{Address: "not-an-address", Role: mail.RoleBcc},
+		{Address: "ben@example.de", Role: mail.RoleBcc},
+		{Address: "invalid to", Role: mail.RoleTo},
+	})
+
+	if results[0].Err != nil || results[1].Err == nil || results[2].Err != nil || results[3].Err == nil {
+		t.Fatalf("expected only the invalid addresses to fail, got %+v", results)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 2 {
+		t.Fatalf("expected 2 messages, got %v", len(envelopes))
+	}
+
+	for i, want := range []string{"ava@example.de", "ben@example.de"} {
+		if len(envelopes[i].To) != 1 || envelopes[i].To[0] != want {
+			t.Errorf("expected copy %d only delivered to %v, got %v", i+1, want, envelopes[i].To)
+		}
+
+		msg, err := stdmail.ReadMessage(strings.NewReader(envelopes[i].Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.Header.Get("To") != "Undisclosed recipients:;" || msg.Header.Get("Cc") != "" || msg.Header.Get("Bcc") != "" {
+			t.Errorf("unexpected headers of copy %d: %v", i+1, msg.Header)
+		}
+	}
+}
+
+func TestSendRolesDryRun(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	cfg := server.Config()
+	cfg.DryRun = true
+	m, err := mail.Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var infos []mail.SendInfo
+	m.OnSend = func(info mail.SendInfo, err error) {
+		infos = append(infos, info)
+	}
+
+	results := m.SendRoles(context.Background(), "test@example.de", mail.MustTemplate("topic", "body"), []mail.RoleRecipient{
+		{Address: "ava@example.de", Role: mail.RoleTo},
+		{Address: "ben@example.de", Role: mail.RoleCc},
+		{Address: "audit@example.de", Role: mail.RoleBcc},
+	})
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 send infos, got %v", len(infos))
+	}
+
+	for i, info := range infos {
+		if info.Recipients != 1 {
+			t.Errorf("expected copy %d to have one recipient, got %v", i+1, info.Recipients)
+		}
+	}
+
+	if server.Connections() != 0 {
+		t.Errorf("expected no connection in dry run, got %d", server.Connections())
+	}
+}
+
+func TestSendAsync(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []<-chan error{
+		m.SendAsync("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "one"}),
+		m.SendAsync("test@example.de", mail.To{"invalid"}, mail.Message{Topic: "two"}),
+	}
+
+	if err = <-results[0]; err != nil {
+		t.Errorf("expected first message to be sent, got %v", err)
+	}
+
+	if err = <-results[1]; err == nil {
+		t.Error("expected error for invalid address")
+	}
+
+	if n := len(server.Envelopes()); n != 1 {
+		t.Errorf("expected 1 message, got %v", n)
+	}
+}
+
+func TestSendBccOnly(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", nil, mail.Message{Topic: "archive"}, mail.Bcc("archive@example.de", "audit@example.de"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := server.Envelopes()[0]
+	if strings.Join(envelope.To, ",") != "archive@example.de,audit@example.de" {
+		t.Errorf("expected the bcc recipients in the envelope, got %v", envelope.To)
+	}
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(envelope.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := msg.Header.Get("To"); got != "Undisclosed recipients:;" {
+		t.Errorf("expected undisclosed recipients, got %q", got)
+	}
+
+	if strings.Contains(envelope.Data, "archive@example.de") {
+		t.Errorf("expected bcc recipients not to be disclosed:\n%s", envelope.Data)
+	}
+
+	err = m.Send("test@example.de", nil, mail.Message{Topic: "archive"}, mail.Cc("ava@example.de"), mail.AsCc())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := server.Envelopes()[1].To; len(got) != 1 || got[0] != "ava@example.de" {
+		t.Errorf("expected the cc recipient in the envelope, got %v", got)
+	}
+
+	err = m.Send("test@example.de", nil, mail.Message{Topic: "nobody"})
+	if err == nil || !strings.Contains(err.Error(), "at least one") {
+		t.Errorf("expected error without recipients, got %v", err)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	server := newSMTPServer(t, nil)
+	server.queueReplies("RCPT", "550 no such user")
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de", "ben@example.de"}, mail.Message{Topic: "topic"},
+		mail.Retry(2, time.Millisecond))
+
+	var sendErrs *mail.SendErrors
+	if !errors.As(err, &sendErrs) {
+		t.Fatalf("expected SendErrors, got %v", err)
+	}
+
+	failed := sendErrs.Failed()
+	if len(failed) != 1 || failed["ava@example.de"] == nil || !sendErrs.Delivered() {
+		t.Errorf("expected only ava to fail, got %v", failed)
+	}
+
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) || protoErr.Code != 550 {
+		t.Errorf("expected the smtp error of the rejected recipient, got %v", err)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 1 || strings.Join(envelopes[0].To, ",") != "ben@example.de" {
+		t.Fatalf("expected one delivery to ben without retry, got %+v", envelopes)
+	}
+
+	server.queueReplies("RCPT", "450 mailbox busy", "450 mailbox busy")
+	err = m.Send("test@example.de", mail.To{"ava@example.de", "ben@example.de"}, mail.Message{Topic: "topic"},
+		mail.Retry(1, time.Millisecond))
+	if err != nil {
+		t.Fatalf("expected retry when all recipients were rejected temporarily, got %v", err)
+	}
+
+	if n := len(server.Envelopes()); n != 2 {
+		t.Errorf("expected 2 messages, got %v", n)
+	}
+}
+
+func TestWithSender(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(from, sender string) (*stdmail.Message, smtpEnvelope) {
+		t.Helper()
+
+		err := m.Send(from, mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}, mail.WithSender(sender))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		envelopes := server.Envelopes()
+		envelope := envelopes[len(envelopes)-1]
+		msg, err := stdmail.ReadMessage(strings.NewReader(envelope.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return msg, envelope
+	}
+
+	msg, envelope := send("Ava Boss <boss@example.de>", "Assistant <assistant@example.de>")
+	if got := msg.Header.Get("Sender"); got != `"Assistant" <assistant@example.de>` {
+		t.Errorf("expected Sender header, got %q", got)
+	}
+
+	if got := msg.Header.Get("From"); got != `"Ava Boss" <boss@example.de>` {
+		t.Errorf("expected From header of from, got %q", got)
+	}
+
+	if envelope.From != "assistant@example.de" {
+		t.Errorf("expected the sender as envelope sender, got %v", envelope.From)
+	}
+
+	msg, _ = send("boss@example.de", "Boss@example.de")
+	if _, ok := msg.Header["Sender"]; ok {
+		t.Errorf("expected no Sender header when it equals from, got %v", msg.Header)
+	}
+
+	err = m.Send("boss@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}, mail.WithSender("assistant"))
+	if err == nil || !strings.Contains(err.Error(), "invalid sender") {
+		t.Errorf("expected invalid sender error, got %v", err)
+	}
+}
+
+func TestConfigured(t *testing.T) {
+	tx := mail.New()
+	if tx.Configured() {
+		t.Error("expected new transmitter not to be configured")
+	}
+
+	tx.UpdateTxConfig(mail.TxConfig{Host: "localhost", AllowUnauthenticated: true})
+	if !tx.Configured() {
+		t.Error("expected transmitter to be configured after UpdateTxConfig")
+	}
+
+	tx, err := mail.Dial(mail.TxConfig{Host: "localhost", AllowUnauthenticated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tx.Configured() {
+		t.Error("expected dialed transmitter to be configured")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"EHLO": "250-localhost\r\n250 AUTH PLAIN"})
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	m.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	message := mail.Message{
+		Topic:       "topic",
+		Body:        "very secret body",
+		ContentType: "text/plain",
+		Attachments: []mail.Attachment{{Name: "logo", Kind: "image/png", Content: pngContent}},
+	}
+	server.queueReplies("MAIL", "451 try again later")
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message, mail.Retry(1, time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, message, mail.Bcc("invalid"))
+	if err == nil {
+		t.Fatal("expected error for invalid address")
+	}
+
+	out := logs.String()
+	for _, want := range []string{"dialing smtp server", "authenticating", "connected to smtp server", "attaching", "name=logo", "retrying send", "mail sent", "mail not sent"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in logs:\n%s", want, out)
+		}
+	}
+
+	for _, secret := range []string{"very secret body", "xxx"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q not to be logged:\n%s", secret, out)
+		}
+	}
+}
+
+func TestErrorCategories(t *testing.T) {
+	auth := "250-localhost\r\n250 AUTH PLAIN"
+	categories := []error{mail.ErrAuth, mail.ErrConnection, mail.ErrRecipientRejected, mail.ErrTemporary}
+
+	tests := map[string]struct {
+		replies map[string]string
+		want    []error
+	}{
+		"invalid credentials":   {map[string]string{"EHLO": auth, "AUTH": "535 5.7.8 invalid credentials"}, []error{mail.ErrAuth}},
+		"auth unavailable":      {map[string]string{"EHLO": auth, "AUTH": "454 4.7.0 try again later"}, []error{mail.ErrAuth, mail.ErrTemporary}},
+		"unknown user":          {map[string]string{"RCPT": "550 5.1.1 no such user"}, []error{mail.ErrRecipientRejected}},
+		"mailbox full":          {map[string]string{"RCPT": "452 4.2.2 mailbox full"}, []error{mail.ErrRecipientRejected, mail.ErrTemporary}},
+		"greylisted":            {map[string]string{"MAIL": "451 4.7.1 greylisted"}, []error{mail.ErrTemporary}},
+		"service not available": {map[string]string{"DATA": "421 4.3.2 service not available"}, []error{mail.ErrTemporary}},
+		"spam":                  {map[string]string{"DATA": "554 5.7.1 message rejected"}, nil},
+	}
+
+	for name, tt := range tests {
+		server := newSMTPServer(t, tt.replies)
+
+		m, err := mail.Dial(server.Config())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+		if err == nil {
+			t.Errorf("%v: expected error", name)
+			continue
+		}
+
+		for _, category := range categories {
+			want := false
+			for _, w := range tt.want {
+				want = want || w == category
+			}
+
+			if got := errors.Is(err, category); got != want {
+				t.Errorf("%v: expected errors.Is(%v) to be %v, got %v for %v", name, category, want, got, err)
+			}
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	l.Close()
+
+	m, err := mail.Dial(mail.TxConfig{Host: addr.IP.String(), Port: addr.Port, AllowUnauthenticated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if !errors.Is(err, mail.ErrConnection) || errors.Is(err, mail.ErrAuth) {
+		t.Errorf("expected connection error for closed port, got %v", err)
+	}
+}
+
+func TestNormalizeRecipients(t *testing.T) {
+	server := newSMTPServer(t, nil)
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("test@example.de", mail.To{" ava@Example.DE ", "ava@example.de\t", "Ava@example.de", "Ben <ben@EXAMPLE.de>"}, mail.Message{Topic: "topic"},
+		mail.Cc("  ben@example.de", "Carl@Example.de "),
+		mail.Bcc("ava@EXAMPLE.DE", "dora@example.de"),
+		mail.NormalizeRecipients(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 1 {
+		t.Fatalf("expected one message, got %v", len(envelopes))
+	}
+
+	if got := strings.Join(envelopes[0].To, ","); got != "ava@example.de,Ava@example.de,ben@example.de,Carl@example.de,dora@example.de" {
+		t.Errorf("unexpected recipients %v", got)
+	}
+
+	msg, err := stdmail.ReadMessage(strings.NewReader(envelopes[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := msg.Header.Get("To"); got != `ava@example.de, Ava@example.de, "Ben" <ben@example.de>` {
+		t.Errorf("unexpected To header %q", got)
+	}
+
+	if got := msg.Header.Get("Cc"); got != "Carl@example.de" {
+		t.Errorf("unexpected Cc header %q", got)
+	}
+}
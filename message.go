@@ -1,11 +1,27 @@
 package mail
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
+	"mime"
 	"net/http"
+	"os"
+	"sort"
 	"strings"
-	"time"
+	"sync"
+	texttemplate "text/template"
+	"unicode"
+
+	oz "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
 )
 
 // Attachment is attachment for message send via smtp server
@@ -13,60 +29,291 @@ type Attachment struct {
 	Name    string `json:"name"`
 	Kind    string `json:"kind"`
 	Content []byte `json:"content"`
+	// Inline embeds the attachment, html bodies can reference it by its name, e.g. <img src="cid:logo">
+	Inline bool `json:"inline,omitempty"`
+	// Open streams the content instead of Content when the message is sent, e.g. for a FileAttachment
+	Open func() (io.ReadCloser, error) `json:"-"`
+
+	// size of the streamed content, when it's known
+	size int64
+}
+
+// Alternative is an alternative body of a message, e.g. a html version of a plain text body
+type Alternative struct {
+	ContentType string `json:"contentType"`
+	Body        string `json:"body"`
 }
 
 // Message is message send via smtp server
 type Message struct {
-	Topic       string       `json:"topic"`
-	Body        string       `json:"body"`
-	Attachments []Attachment `json:"attachments"`
-	ContentType string       `json:"contentType"`
+	Topic        string        `json:"topic"`
+	Body         string        `json:"body"`
+	Attachments  []Attachment  `json:"attachments"`
+	ContentType  string        `json:"contentType"`
+	Alternatives []Alternative `json:"alternatives"`
+	// Charset of the topic, body and alternatives when they are sent, UTF-8 when empty
+	Charset string `json:"charset,omitempty"`
+	// Encoding is the transfer encoding of the body and alternatives, quoted-printable when empty
+	Encoding TransferEncoding `json:"encoding,omitempty"`
+}
+
+// TransferEncoding is the Content-Transfer-Encoding of bodies
+type TransferEncoding string
+
+const (
+	// EncodingQuotedPrintable encodes bodies as quoted-printable, as defined in RFC 2045
+	EncodingQuotedPrintable TransferEncoding = "quoted-printable"
+	// EncodingBase64 encodes bodies as base64, as defined in RFC 2045
+	EncodingBase64 TransferEncoding = "base64"
+	// EncodingUnencoded sends bodies as they are, the server must support 8BITMIME for non-ASCII bodies
+	EncodingUnencoded TransferEncoding = "8bit"
+)
+
+// knownContentTypes are the content types of bodies and alternatives accepted by Message.Validate
+var knownContentTypes = []interface{}{"text/plain", "text/html"}
+
+// mediaType checks that a string is a media type, parameters like charset are ignored
+func mediaType(in ...interface{}) oz.Rule {
+	return oz.By(func(value interface{}) error {
+		s, _ := value.(string)
+		if s == "" {
+			return nil
+		}
+
+		t, _, err := mime.ParseMediaType(s)
+		if err != nil {
+			return errors.New("must be a valid media type")
+		}
+
+		if len(in) > 0 {
+			return oz.In(in...).Error("must be text/plain or text/html").Validate(t)
+		}
+
+		return nil
+	})
+}
+
+// Validate checks that the attachment has a name, content and a valid Kind
+func (a Attachment) Validate() error {
+	return oz.ValidateStruct(&a,
+		oz.Field(&a.Name, oz.Required),
+		oz.Field(&a.Kind, oz.Required, mediaType()),
+		oz.Field(&a.Content, oz.When(a.Open == nil, oz.Required)),
+	)
+}
+
+// Validate checks that the alternative has a known content type
+func (a Alternative) Validate() error {
+	return oz.ValidateStruct(&a,
+		oz.Field(&a.ContentType, oz.Required, mediaType(knownContentTypes...)),
+	)
+}
+
+// Validate checks that the message has a topic, known content types and valid attachments
+func (m Message) Validate() error {
+	return oz.ValidateStruct(&m,
+		oz.Field(&m.Topic, oz.Required),
+		oz.Field(&m.ContentType, oz.Required, mediaType(knownContentTypes...)),
+		oz.Field(&m.Alternatives),
+		oz.Field(&m.Attachments),
+		oz.Field(&m.Encoding, oz.In(EncodingQuotedPrintable, EncodingBase64, EncodingUnencoded)),
+		oz.Field(&m.Charset, oz.By(func(interface{}) error {
+			if isUTF8(m.Charset) {
+				return nil
+			}
+
+			_, err := charsetEncoding(m.Charset)
+			return err
+		})),
+	)
 }
 
 // RequestAttachment can be used in the request struct when attachments are allowed
 type RequestAttachment struct {
 	Name string `json:"name"`
-	// Content base64 encoded content
-	Content []byte `json:"content"`
+	// Content base64 encoded content, decoded when the template is executed
+	Content string `json:"content"`
+	// Kind is the mime type of the content, it's detected from the content when empty
+	Kind string `json:"kind,omitempty"`
+	// Inline embeds the attachment, see Attachment.Inline
+	Inline bool `json:"inline,omitempty"`
 }
 
 // RequestAttachments list of RequestAttachments
 type RequestAttachments []RequestAttachment
 
+// RawAttachment is like RequestAttachment but carries already decoded content
+type RawAttachment struct {
+	Name    string `json:"name"`
+	Content []byte `json:"content"`
+	// Kind is the mime type of the content, it's detected from the content when empty
+	Kind string `json:"kind,omitempty"`
+	// Inline embeds the attachment, see Attachment.Inline
+	Inline bool `json:"inline,omitempty"`
+}
+
+// cleanBase64 removes whitespace and padding, so it can be decoded with base64.RawStdEncoding
+func cleanBase64(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	return strings.TrimRight(s, "=")
+}
+
+// Decode decodes the base64 content of the attachment.
+// Line breaks and missing padding are accepted.
+func (a RequestAttachment) Decode() (raw RawAttachment, err error) {
+	return a.decode(cleanBase64(a.Content))
+}
+
+func (a RequestAttachment) decode(cleaned string) (raw RawAttachment, err error) {
+	content, err := base64.RawStdEncoding.DecodeString(cleaned)
+	if err != nil {
+		err = fmt.Errorf("couldn't decode content of attachment %v: %v", a.Name, err)
+		return
+	}
+
+	return RawAttachment{Name: a.Name, Content: content, Kind: a.Kind, Inline: a.Inline}, nil
+}
+
 // Template template for message
 type Template struct {
-	topic                  *template.Template
-	body                   *template.Template
+	topic                  executor
+	body                   executor
+	htmlBody               executor
 	allowedAttachmentTypes map[string]struct{}
 	funcs                  template.FuncMap
 	contentType            string
 	attachments            RequestAttachments
+	rawAttachments         []RawAttachment
+	partials               map[string]string
+	markdown               bool
+	markdownUnsafe         bool
+	maxAttachmentSize      int64
+	maxMessageSize         int64
+	maxAttachments         *int
+	locale                 string
+	autoTextAlternative    bool
+	inlineCSS              bool
+	strict                 bool
+	streamAttachments      []streamAttachment
+	charset                string
+	encoding               TransferEncoding
+	signatureSource        string
+	signature              executor
+	htmlSignature          executor
+	defaults               map[string]interface{}
+	verifyAttachmentType   bool
 }
 
 func processAttachments(
 	allowed map[string]struct{},
+	maxSize int64,
+	verify bool,
 	attachments RequestAttachments,
+	rawAttachments []RawAttachment,
 ) (aa []Attachment, err error) {
+	raw := make([]RawAttachment, 0, len(attachments)+len(rawAttachments))
 	for _, attachment := range attachments {
-		mimeType := http.DetectContentType(attachment.Content)
-		if _, ok := allowed[mimeType]; !ok {
+		// reject oversized attachments before their content is decoded
+		cleaned := cleanBase64(attachment.Content)
+		if maxSize > 0 && int64(base64.RawStdEncoding.DecodedLen(len(cleaned))) > maxSize {
+			return aa, fmt.Errorf("attachment %v exceeds max size of %d bytes", attachment.Name, maxSize)
+		}
+
+		decoded, err := attachment.decode(cleaned)
+		if err != nil {
+			return aa, err
+		}
+
+		raw = append(raw, decoded)
+	}
+	raw = append(raw, rawAttachments...)
+
+	for _, attachment := range raw {
+		content := attachment.Content
+		if len(content) == 0 {
+			return aa, fmt.Errorf("attachment %v is empty", attachment.Name)
+		}
+
+		if maxSize > 0 && int64(len(content)) > maxSize {
+			return aa, fmt.Errorf("attachment %v exceeds max size of %d bytes", attachment.Name, maxSize)
+		}
+
+		mimeType := attachment.Kind
+		if mimeType == "" {
+			mimeType = http.DetectContentType(content)
+		} else if _, _, err := mime.ParseMediaType(mimeType); err != nil {
+			return aa, fmt.Errorf("attachment %v has invalid MIME Type %q: %v", attachment.Name, mimeType, err)
+		}
+
+		if !typeAllowed(allowed, mimeType) {
 			return aa, fmt.Errorf("MIME Type %v is not allowed", mimeType)
 		}
 
+		if verify {
+			if err := verifyKind(attachment.Name, mimeType, content); err != nil {
+				return aa, err
+			}
+		}
+
 		aa = append(aa, Attachment{
 			Name:    attachment.Name,
 			Kind:    mimeType,
-			Content: attachment.Content,
+			Content: content,
+			Inline:  attachment.Inline,
 		})
 	}
 
 	return
 }
 
-func executeTemplate(tpl *template.Template, data interface{}) (s string, err error) {
+func renderMarkdown(source string, unsafe bool) (s string, err error) {
+	var rendererOptions []renderer.Option
+	if unsafe {
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
+
+	md := goldmark.New(goldmark.WithRendererOptions(rendererOptions...))
+
 	var buf strings.Builder
+	err = md.Convert([]byte(source), &buf)
+	if err != nil {
+		return
+	}
+
+	return buf.String(), err
+}
+
+// maxPooledBuffer is the max capacity of buffers put back into bufferPool,
+// so a single huge message doesn't keep its memory alive
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
 
-	err = tpl.Execute(&buf, data)
+// executor is a parsed html/template or text/template
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+func executeTemplate(tpl executor, data interface{}) (s string, err error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	err = tpl.Execute(buf, data)
 	if err != nil {
 		return
 	}
@@ -74,6 +321,43 @@ func executeTemplate(tpl *template.Template, data interface{}) (s string, err er
 	return buf.String(), err
 }
 
+// Signature appends the template signature to the rendered body, it's executed with the data of the body.
+// Plain text bodies get the signature after the "-- " separator line, html bodies before </body>.
+// For multipart templates it's appended to both bodies.
+func Signature(signature string) Option {
+	return func(tpl *Template) {
+		tpl.signatureSource = signature
+		tpl.signature = nil
+		tpl.htmlSignature = nil
+	}
+}
+
+// parseSignature parses the signature for the body and, for multipart templates, for the html body
+func (tpl *Template) parseSignature() (err error) {
+	tpl.signature, err = tpl.parseBody("signature", tpl.signatureSource, tpl.htmlEscaped())
+	if err == nil && tpl.htmlBody != nil {
+		tpl.htmlSignature, err = tpl.parseBody("signature", tpl.signatureSource, true)
+	}
+	if err != nil {
+		err = fmt.Errorf("couldn't parse signature: %v", err)
+	}
+
+	return
+}
+
+// appendSignature appends signature to body of contentType
+func appendSignature(contentType, body, signature string) string {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" {
+		return strings.TrimRight(body, "\r\n") + "\n\n-- \n" + signature
+	}
+
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + signature + body[i:]
+	}
+
+	return body + signature
+}
+
 // WithAttachments add attacments to a message
 func WithAttachments(attachments RequestAttachments) Option {
 	return func(tpl *Template) {
@@ -81,12 +365,54 @@ func WithAttachments(attachments RequestAttachments) Option {
 	}
 }
 
-// Execute builds message with given data and options
+// WithRawAttachments add attachments with already decoded content to a message
+func WithRawAttachments(attachments ...RawAttachment) Option {
+	return func(tpl *Template) {
+		tpl.rawAttachments = attachments
+	}
+}
+
+// WithInlineImages embeds images which html bodies can reference by name, e.g. <img src="cid:logo">.
+// The image types must be allowed with AllowAttachments like for any other attachment.
+func WithInlineImages(images ...RawAttachment) Option {
+	return func(tpl *Template) {
+		for _, image := range images {
+			image.Inline = true
+			tpl.rawAttachments = append(tpl.rawAttachments, image)
+		}
+	}
+}
+
+// Execute builds message with given data and options. TemplateFuncs, Locale and WithPartials
+// only apply when the template is parsed, Execute fails with them. Execute fails as well when
+// ContentType or Markdown switches the body between html and plain text, because the body
+// is escaped depending on its content type when it's parsed.
 func (tpl Template) Execute(data interface{}, opts ...Option) (msg Message, err error) {
+	escaped := tpl.htmlEscaped()
+	// the options get fresh maps, the maps of tpl are shared by all copies of the template
+	funcs, partials := tpl.funcs, tpl.partials
+	tpl.funcs, tpl.partials = template.FuncMap{}, nil
 	for _, opt := range opts {
 		opt(&tpl)
 	}
 
+	if len(tpl.funcs) > 0 || tpl.partials != nil {
+		err = errors.New("template funcs, locale and partials can only be set when the template is created")
+		return
+	}
+	tpl.funcs, tpl.partials = funcs, partials
+
+	if tpl.htmlEscaped() != escaped {
+		err = errors.New("html and plain text bodies can only be switched when the template is created")
+		return
+	}
+
+	if tpl.defaults != nil {
+		if data, err = mergeDefaults(tpl.defaults, data); err != nil {
+			return
+		}
+	}
+
 	topic, err := executeTemplate(tpl.topic, data)
 	if err != nil {
 		return
@@ -98,33 +424,220 @@ func (tpl Template) Execute(data interface{}, opts ...Option) (msg Message, err
 		return
 	}
 	msg.Body = body
+	msg.ContentType = tpl.contentType
+	msg.Charset = tpl.charset
+	msg.Encoding = tpl.encoding
+
+	if tpl.markdown {
+		msg.Body, err = renderMarkdown(body, tpl.markdownUnsafe)
+		if err != nil {
+			err = fmt.Errorf("couldn't render markdown: %v", err)
+			return
+		}
+		msg.ContentType = "text/html"
+	}
+
+	if tpl.signatureSource != "" {
+		if tpl.signature == nil || (tpl.htmlBody != nil && tpl.htmlSignature == nil) {
+			if err = tpl.parseSignature(); err != nil {
+				return
+			}
+		}
+
+		var signature string
+		signature, err = executeTemplate(tpl.signature, data)
+		if err != nil {
+			return
+		}
+
+		msg.Body = appendSignature(msg.ContentType, msg.Body, signature)
+	}
+
+	if tpl.htmlBody != nil {
+		var htmlBody string
+		htmlBody, err = executeTemplate(tpl.htmlBody, data)
+		if err != nil {
+			return
+		}
+
+		if tpl.htmlSignature != nil {
+			var signature string
+			signature, err = executeTemplate(tpl.htmlSignature, data)
+			if err != nil {
+				return
+			}
+
+			htmlBody = appendSignature("text/html", htmlBody, signature)
+		}
+
+		if tpl.inlineCSS {
+			htmlBody, err = inlineCSS(htmlBody)
+			if err != nil {
+				err = fmt.Errorf("couldn't inline css: %v", err)
+				return
+			}
+		}
+
+		msg.Alternatives = append(msg.Alternatives, Alternative{
+			ContentType: "text/html",
+			Body:        htmlBody,
+		})
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(msg.ContentType)
+	if tpl.inlineCSS && mediaType == "text/html" {
+		msg.Body, err = inlineCSS(msg.Body)
+		if err != nil {
+			err = fmt.Errorf("couldn't inline css: %v", err)
+			return
+		}
+	}
+
+	if tpl.autoTextAlternative && tpl.htmlBody == nil && mediaType == "text/html" {
+		msg.Alternatives = append([]Alternative{{ContentType: msg.ContentType, Body: msg.Body}}, msg.Alternatives...)
+		msg.Body = htmlToText(msg.Body)
+		msg.ContentType = "text/plain"
+	}
+
+	supplied := len(tpl.attachments) + len(tpl.rawAttachments) + len(tpl.streamAttachments)
+	if tpl.maxAttachments != nil && supplied > *tpl.maxAttachments {
+		err = fmt.Errorf(
+			"too many attachments: %d supplied, but only %d allowed",
+			supplied,
+			*tpl.maxAttachments,
+		)
+		return
+	}
 
 	var messageAttachments []Attachment
 	messageAttachments, err = processAttachments(
 		tpl.allowedAttachmentTypes,
+		tpl.maxAttachmentSize,
+		tpl.verifyAttachmentType,
 		tpl.attachments,
+		tpl.rawAttachments,
 	)
 	if err != nil {
 		err = fmt.Errorf("wrong attachment: %v", err)
 		return
 	}
 
-	msg.Attachments = messageAttachments
-	msg.ContentType = tpl.contentType
+	streamed, err := processStreamAttachments(tpl.allowedAttachmentTypes, tpl.maxAttachmentSize, tpl.verifyAttachmentType, tpl.streamAttachments)
+	if err != nil {
+		err = fmt.Errorf("wrong attachment: %v", err)
+		return
+	}
+
+	msg.Attachments = append(messageAttachments, streamed...)
+
+	if size := msg.EstimatedSize(); tpl.maxMessageSize > 0 && size > tpl.maxMessageSize {
+		err = fmt.Errorf("message too large: about %d bytes, but only %d allowed", size, tpl.maxMessageSize)
+		return
+	}
 
 	return
 }
 
+// ExecuteContext is like Execute but returns ctx.Err() when ctx is done before the message is built,
+// e.g. when a func of TemplateFuncs hangs. Execute keeps running in the background until it returns,
+// so the funcs should give up on their own eventually.
+func (tpl Template) ExecuteContext(ctx context.Context, data interface{}, opts ...Option) (msg Message, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	type result struct {
+		msg Message
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		msg, err := tpl.Execute(data, opts...)
+		done <- result{msg: msg, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.msg, r.err
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	}
+}
+
+// Estimated sizes of the headers of a message and of a part, like a body or an attachment
+const (
+	messageHeaderSize = 512
+	partHeaderSize    = 128
+)
+
+// base64Size returns the size of n bytes encoded as base64 with lines of 76 characters
+func base64Size(n int64) int64 {
+	encoded := (n + 2) / 3 * 4
+	return encoded + (encoded+75)/76*2
+}
+
+// EstimatedSize returns about the size of the message when it's sent, including the
+// base64 encoding of attachments and the headers. Attachments streamed from a reader
+// are not included, because their size is unknown until they are sent.
+func (m Message) EstimatedSize() int64 {
+	size := int64(messageHeaderSize + len(m.Topic) + partHeaderSize + len(m.Body))
+	for _, alt := range m.Alternatives {
+		size += int64(partHeaderSize + len(alt.Body))
+	}
+
+	for _, a := range m.Attachments {
+		n := int64(len(a.Content))
+		if a.Open != nil {
+			n = a.size
+		}
+		size += int64(partHeaderSize+len(a.Name)*2) + base64Size(n)
+	}
+
+	return size
+}
+
 // Option option to configure template
 type Option func(*Template)
 
-// AllowAttachments allows attachements for letter
+// AllowAttachments allows attachements for letter.
+// Types can be exact like image/png, families like image/* or */* to allow any type.
 func AllowAttachments(types ...string) Option {
 	return func(opts *Template) {
 		opts.allowedAttachmentTypes = makeAllowedAttachmentTypesIdx(types)
 	}
 }
 
+// MaxAttachmentSize limits the size of every decoded attachment to max bytes.
+// Attachments are unlimited when not set.
+func MaxAttachmentSize(max int64) Option {
+	return func(opts *Template) {
+		opts.maxAttachmentSize = max
+	}
+}
+
+// MaxMessageSize rejects messages whose EstimatedSize exceeds max bytes when the template
+// is executed, e.g. the SIZE limit of the smtp server. Messages are unlimited when not set.
+func MaxMessageSize(max int64) Option {
+	return func(opts *Template) {
+		opts.maxMessageSize = max
+	}
+}
+
+// MaxAttachments limits the number of attachments per message to max.
+// Zero allows no attachments, attachments are unlimited when not set or max is negative.
+func MaxAttachments(max int) Option {
+	return func(opts *Template) {
+		if max < 0 {
+			opts.maxAttachments = nil
+			return
+		}
+
+		opts.maxAttachments = &max
+	}
+}
+
 // ContentType is content-type of message
 func ContentType(kind string) Option {
 	return func(opts *Template) {
@@ -141,56 +654,123 @@ func TemplateFuncs(funcs template.FuncMap) Option {
 	}
 }
 
-var days = map[time.Weekday]string{
-	time.Monday:    "Montag",
-	time.Tuesday:   "Dienstag",
-	time.Wednesday: "Mittwoch",
-	time.Thursday:  "Donnerstag",
-	time.Friday:    "Freitag",
-	time.Saturday:  "Samstag",
-	time.Sunday:    "Sonntag",
+// Encoding sets the transfer encoding of the bodies, e.g. EncodingQuotedPrintable for text
+// parts which must stay readable, the default is quoted-printable.
+func Encoding(enc TransferEncoding) Option {
+	return func(tpl *Template) {
+		tpl.encoding = enc
+	}
 }
 
-var months = map[time.Month]string{
-	time.January:   "Januar",
-	time.February:  "Februar",
-	time.March:     "März",
-	time.April:     "April",
-	time.May:       "Mai",
-	time.June:      "Juni",
-	time.July:      "Juli",
-	time.August:    "August",
-	time.September: "September",
-	time.October:   "Oktober",
-	time.November:  "November",
-	time.December:  "Dezember",
+// Charset sends the messages of the template in charset, e.g. ISO-8859-1 for legacy recipients,
+// instead of UTF-8. Sending fails when the message has characters charset can't represent.
+func Charset(charset string) Option {
+	return func(tpl *Template) {
+		tpl.charset = charset
+	}
 }
 
-func longDateGerman(t time.Time) string {
-	day := days[t.Weekday()]
-	month := months[t.Month()]
+// Locale selects the locale of number, currency and the timef formats without a locale suffix, e.g. date-long.
+// Supported locales are de (default) and en.
+func Locale(tag string) Option {
+	return func(opts *Template) {
+		opts.locale = tag
+		opts.funcs["timef"] = localizedTimef(tag)
+		opts.funcs["timefIn"] = localizedTimefIn(tag)
+		opts.funcs["number"] = localizedNumber(tag)
+		opts.funcs["currency"] = localizedCurrency(tag)
+	}
+}
 
-	return fmt.Sprintf("%s, %02d. %s %d", day[:2], t.Day(), month, t.Year())
+// StrictTemplates makes Execute fail for missing map keys instead of rendering an empty value.
+// Missing struct fields fail with and without StrictTemplates.
+func StrictTemplates() Option {
+	return func(opts *Template) {
+		opts.strict = true
+	}
 }
 
-func longTimeGerman(t time.Time) string {
-	return fmt.Sprintf("%s %02d:%02d:%02d", longDateGerman(t), t.Hour(), t.Minute(), t.Second())
+// InlineCSS applies the rules of <style> elements in html bodies as style attributes,
+// because many mail clients ignore stylesheets. Media queries and rules with selectors
+// other than types, classes and ids stay in the stylesheet.
+func InlineCSS() Option {
+	return func(opts *Template) {
+		opts.inlineCSS = true
+	}
 }
 
-func timef(t time.Time, format string) string {
-	switch format {
-	case "date-short-de":
-		return t.Format("02.01.2006")
-	case "date-long-de":
-		return longDateGerman(t)
-	case "time-short-de":
-		return t.Format("02.01.2006 15:04:05")
-	case "time-long-de":
-		return longTimeGerman(t)
-	default:
-		return t.Format(format)
+// AutoTextAlternative generates a plain text version of html bodies. The text becomes the body
+// and the html its alternative, so mail clients still prefer the html version.
+// It has no effect on multipart templates which have an explicit text body.
+func AutoTextAlternative() Option {
+	return func(opts *Template) {
+		opts.autoTextAlternative = true
 	}
+}
+
+// Markdown treats the rendered body as markdown and converts it to html.
+// Raw html in the markdown is omitted, use MarkdownUnsafe to keep it.
+func Markdown() Option {
+	return func(opts *Template) {
+		opts.markdown = true
+	}
+}
 
+// MarkdownUnsafe is like Markdown but keeps raw html in the markdown
+func MarkdownUnsafe() Option {
+	return func(opts *Template) {
+		opts.markdown = true
+		opts.markdownUnsafe = true
+	}
+}
+
+// WithPartials adds named templates which can be used in body templates, e.g. {{template "footer" .}}
+func WithPartials(partials map[string]string) Option {
+	return func(opts *Template) {
+		if opts.partials == nil {
+			opts.partials = map[string]string{}
+		}
+
+		for name, partial := range partials {
+			opts.partials[name] = partial
+		}
+	}
+}
+
+// AllowedAttachmentTypes returns the sorted types allowed with AllowAttachments, including
+// families like image/*, e.g. to show them in an upload form
+func (tpl Template) AllowedAttachmentTypes() []string {
+	types := make([]string, 0, len(tpl.allowedAttachmentTypes))
+	for kind := range tpl.allowedAttachmentTypes {
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// typeAllowed reports whether the detected mime type is allowed exactly,
+// by its family like image/* or by */*
+func typeAllowed(allowed map[string]struct{}, mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = mimeType
+	}
+
+	for _, t := range []string{mimeType, mediaType} {
+		if _, ok := allowed[t]; ok {
+			return true
+		}
+	}
+
+	if family, _, ok := strings.Cut(mediaType, "/"); ok {
+		if _, ok := allowed[family+"/*"]; ok {
+			return true
+		}
+	}
+
+	_, ok := allowed["*/*"]
+	return ok
 }
 
 func makeAllowedAttachmentTypesIdx(types []string) map[string]struct{} {
@@ -202,11 +782,96 @@ func makeAllowedAttachmentTypesIdx(types []string) map[string]struct{} {
 	return idx
 }
 
-// NewTemplate creates new template
+// htmlEscaped reports whether the body is html, then it's parsed with html/template so the
+// data is escaped. Markdown bodies are escaped as well, because they can contain html.
+func (tpl Template) htmlEscaped() bool {
+	mediaType, _, _ := mime.ParseMediaType(tpl.contentType)
+	return mediaType == "text/html" || tpl.markdown
+}
+
+func (tpl Template) newTextTemplate(name string) *texttemplate.Template {
+	t := texttemplate.New(name).Funcs(tpl.funcs).Funcs(texttemplate.FuncMap{emptyNoValueFunc: emptyNoValue})
+	if tpl.strict {
+		t = t.Option("missingkey=error")
+	}
+
+	return t
+}
+
+func (tpl Template) newHTMLTemplate(name string) *template.Template {
+	t := template.New(name).Funcs(tpl.funcs)
+	if tpl.strict {
+		t = t.Option("missingkey=error")
+	}
+
+	return t
+}
+
+// parseBody parses body with the partials, with html/template when escaped is set and
+// with text/template otherwise
+func (tpl Template) parseBody(name, body string, escaped bool) (t executor, err error) {
+	var parsePartial func(name, partial string) error
+	if escaped {
+		var h *template.Template
+		if h, err = tpl.newHTMLTemplate(name).Parse(body); err != nil {
+			return
+		}
+		t = h
+		parsePartial = func(name, partial string) (err error) {
+			_, err = h.New(name).Parse(partial)
+			return
+		}
+	} else {
+		var txt *texttemplate.Template
+		if txt, err = tpl.newTextTemplate(name).Parse(body); err != nil {
+			return
+		}
+		t = txt
+		parsePartial = func(name, partial string) (err error) {
+			_, err = txt.New(name).Parse(partial)
+			return
+		}
+	}
+
+	names := make([]string, 0, len(tpl.partials))
+	for name := range tpl.partials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err = parsePartial(name, tpl.partials[name]); err != nil {
+			err = fmt.Errorf("couldn't parse partial %q: %v", name, err)
+			return
+		}
+	}
+
+	if txt, ok := t.(*texttemplate.Template); ok {
+		printEmptyNoValue(txt)
+	}
+
+	return
+}
+
+// NewTemplate creates new template.
+// The topic and plain text bodies are parsed with text/template, html and markdown bodies with html/template,
+// which escapes the data. The content type is chosen with the ContentType option, it's text/plain by default.
+// The default template funcs are timef, timefIn, number, currency, upper, lower, title, trim, truncate, default and join,
+// they can be overridden with TemplateFuncs.
 func NewTemplate(topic, body string, options ...Option) (tpl Template, err error) {
 	tpl.contentType = "text/plain"
 	tpl.funcs = template.FuncMap{
-		"timef": timef,
+		"timef":    timef,
+		"timefIn":  timefIn,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"title":    title,
+		"trim":     strings.TrimSpace,
+		"truncate": truncate,
+		"default":  defaultValue,
+		"join":     join,
+		"number":   localizedNumber(defaultLocale),
+		"currency": localizedCurrency(defaultLocale),
 	}
 
 	for _, option := range options {
@@ -217,15 +882,123 @@ func NewTemplate(topic, body string, options ...Option) (tpl Template, err error
 		tpl.allowedAttachmentTypes = map[string]struct{}{}
 	}
 
-	tpl.topic, err = template.New("subject").Funcs(tpl.funcs).Parse(topic)
+	if _, ok := locales[tpl.locale]; tpl.locale != "" && !ok {
+		err = fmt.Errorf("unknown locale %q", tpl.locale)
+		return
+	}
+
+	if !isUTF8(tpl.charset) {
+		if _, err = charsetEncoding(tpl.charset); err != nil {
+			return
+		}
+	}
+
+	switch tpl.encoding {
+	case "", EncodingQuotedPrintable, EncodingBase64, EncodingUnencoded:
+	default:
+		err = fmt.Errorf("unknown encoding %q", tpl.encoding)
+		return
+	}
+
+	topicTemplate, err := tpl.newTextTemplate("subject").Parse(topic)
 	if err != nil {
 		return
 	}
+	printEmptyNoValue(topicTemplate)
+	tpl.topic = topicTemplate
 
-	tpl.body, err = template.New("body").Funcs(tpl.funcs).Parse(body)
+	tpl.body, err = tpl.parseBody("body", body, tpl.htmlEscaped())
 	if err != nil {
 		return
 	}
 
+	if tpl.signatureSource != "" {
+		if err = tpl.parseSignature(); err != nil {
+			return
+		}
+	}
+
 	return
 }
+
+// MustTemplate is like NewTemplate but panics when the template can't be created,
+// e.g. for package level templates: var welcome = mail.MustTemplate(topic, body)
+func MustTemplate(topic, body string, options ...Option) Template {
+	tpl, err := NewTemplate(topic, body, options...)
+	if err != nil {
+		panic(err)
+	}
+
+	return tpl
+}
+
+// NewMultipartTemplate creates new template with a plain text body and a html alternative.
+// The text body is always text/plain, a ContentType option is ignored.
+// Markdown and MarkdownUnsafe can't be used with multipart templates.
+func NewMultipartTemplate(topic, textBody, htmlBody string, options ...Option) (tpl Template, err error) {
+	// the text body is parsed as text/plain, so it isn't html escaped
+	options = append(options[:len(options):len(options)], ContentType("text/plain"))
+	tpl, err = NewTemplate(topic, textBody, options...)
+	if err != nil {
+		return
+	}
+
+	if tpl.markdown {
+		err = errors.New("markdown can't be used with multipart templates")
+		return
+	}
+
+	tpl.htmlBody, err = tpl.parseBody("htmlBody", htmlBody, true)
+	if err != nil {
+		return
+	}
+
+	if tpl.signatureSource != "" {
+		err = tpl.parseSignature()
+	}
+
+	return
+}
+
+func readTemplateFiles(
+	readFile func(name string) ([]byte, error),
+	topicPath, bodyPath string,
+) (topic, body string, err error) {
+	b, err := readFile(topicPath)
+	if err != nil {
+		err = fmt.Errorf("couldn't read topic template: %v", err)
+		return
+	}
+	topic = string(b)
+
+	b, err = readFile(bodyPath)
+	if err != nil {
+		err = fmt.Errorf("couldn't read body template: %v", err)
+		return
+	}
+	body = string(b)
+
+	return
+}
+
+// NewTemplateFS creates new template from topic and body files in fsys
+func NewTemplateFS(fsys fs.FS, topicPath, bodyPath string, options ...Option) (tpl Template, err error) {
+	topic, body, err := readTemplateFiles(func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	}, topicPath, bodyPath)
+	if err != nil {
+		return
+	}
+
+	return NewTemplate(topic, body, options...)
+}
+
+// NewTemplateFiles creates new template from topic and body files
+func NewTemplateFiles(topicPath, bodyPath string, options ...Option) (tpl Template, err error) {
+	topic, body, err := readTemplateFiles(os.ReadFile, topicPath, bodyPath)
+	if err != nil {
+		return
+	}
+
+	return NewTemplate(topic, body, options...)
+}
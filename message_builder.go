@@ -0,0 +1,101 @@
+package mail
+
+import (
+	"net/http"
+)
+
+// MessageBuilder assembles a Message step by step, e.g. when its content isn't rendered
+// from a Template. The methods can be chained:
+//
+//	message, err := mail.NewMessageBuilder().
+//		SetSubject("Your invoice").
+//		SetTextBody("Please find your invoice attached.").
+//		AddAttachment("invoice.pdf", pdf, "application/pdf").
+//		Build()
+type MessageBuilder struct {
+	subject     string
+	textBody    string
+	htmlBody    string
+	attachments []Attachment
+	charset     string
+	encoding    TransferEncoding
+}
+
+// NewMessageBuilder returns an empty MessageBuilder
+func NewMessageBuilder() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// SetSubject sets the topic of the message
+func (b *MessageBuilder) SetSubject(subject string) *MessageBuilder {
+	b.subject = subject
+	return b
+}
+
+// SetTextBody sets the plain text body, it's the body of the message and a html body its alternative
+func (b *MessageBuilder) SetTextBody(body string) *MessageBuilder {
+	b.textBody = body
+	return b
+}
+
+// SetHTMLBody sets the html body, it's the body of the message unless a text body is set
+func (b *MessageBuilder) SetHTMLBody(body string) *MessageBuilder {
+	b.htmlBody = body
+	return b
+}
+
+// AddAttachment attaches content as name, kind is detected from the content when empty
+func (b *MessageBuilder) AddAttachment(name string, content []byte, kind string) *MessageBuilder {
+	b.attachments = append(b.attachments, newBuiltAttachment(name, content, kind, false))
+	return b
+}
+
+// AddInlineImage embeds the image content, html bodies can reference it by its name, e.g. <img src="cid:logo">.
+// kind is detected from the content when empty.
+func (b *MessageBuilder) AddInlineImage(name string, content []byte, kind string) *MessageBuilder {
+	b.attachments = append(b.attachments, newBuiltAttachment(name, content, kind, true))
+	return b
+}
+
+// SetCharset sets Message.Charset
+func (b *MessageBuilder) SetCharset(charset string) *MessageBuilder {
+	b.charset = charset
+	return b
+}
+
+// SetEncoding sets Message.Encoding
+func (b *MessageBuilder) SetEncoding(enc TransferEncoding) *MessageBuilder {
+	b.encoding = enc
+	return b
+}
+
+func newBuiltAttachment(name string, content []byte, kind string, inline bool) Attachment {
+	if kind == "" {
+		kind = http.DetectContentType(content)
+	}
+
+	return Attachment{Name: name, Kind: kind, Content: content, Inline: inline}
+}
+
+// Build returns the message, which fails Message.Validate when e.g. the subject is missing
+func (b *MessageBuilder) Build() (msg Message, err error) {
+	msg = Message{
+		Topic:       b.subject,
+		Body:        b.textBody,
+		ContentType: "text/plain",
+		Attachments: append([]Attachment{}, b.attachments...),
+		Charset:     b.charset,
+		Encoding:    b.encoding,
+	}
+
+	switch {
+	case b.htmlBody != "" && b.textBody != "":
+		msg.Alternatives = []Alternative{{ContentType: "text/html", Body: b.htmlBody}}
+	case b.htmlBody != "":
+		msg.Body = b.htmlBody
+		msg.ContentType = "text/html"
+	}
+
+	err = msg.Validate()
+	return
+}
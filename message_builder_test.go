@@ -0,0 +1,60 @@
+package mail_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	msg, err := mail.NewMessageBuilder().
+		SetSubject("Your invoice").
+		SetTextBody("Please find your invoice attached.").
+		SetHTMLBody(`<p>Please find your invoice attached.</p><img src="cid:logo.png">`).
+		AddAttachment("invoice.pdf", []byte("%PDF-1.4\n"), "").
+		AddInlineImage("logo.png", png, "image/png").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := mail.Message{
+		Topic:       "Your invoice",
+		Body:        "Please find your invoice attached.",
+		ContentType: "text/plain",
+		Alternatives: []mail.Alternative{
+			{ContentType: "text/html", Body: `<p>Please find your invoice attached.</p><img src="cid:logo.png">`},
+		},
+		Attachments: []mail.Attachment{
+			{Name: "invoice.pdf", Kind: "application/pdf", Content: []byte("%PDF-1.4\n")},
+			{Name: "logo.png", Kind: "image/png", Content: png, Inline: true},
+		},
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("expected %+v, got %+v", want, msg)
+	}
+
+	data := sendToServer(t, mail.To{"ava@example.de"}, msg)
+	for _, part := range []string{"Subject: Your invoice", "Content-Type: text/html", `filename="invoice.pdf"`, "Content-ID: <logo.png>"} {
+		if !strings.Contains(data, part) {
+			t.Errorf("expected %q in message:\n%s", part, data)
+		}
+	}
+
+	msg, err = mail.NewMessageBuilder().SetSubject("topic").SetHTMLBody("<p>hi</p>").Build()
+	if err != nil || msg.ContentType != "text/html" || len(msg.Alternatives) != 0 {
+		t.Errorf("expected html body, got %+v: %v", msg, err)
+	}
+
+	if _, err = mail.NewMessageBuilder().SetTextBody("body").Build(); err == nil {
+		t.Error("expected error for missing subject")
+	}
+
+	if _, err = mail.NewMessageBuilder().SetSubject("topic").AddAttachment("empty.txt", nil, "text/plain").Build(); err == nil {
+		t.Error("expected error for empty attachment")
+	}
+}
@@ -0,0 +1,846 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/f9a/mail"
+)
+
+func TestNewTemplateFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"welcome/topic.tmpl": {Data: []byte("Welcome {{.Name}}")},
+		"welcome/body.tmpl":  {Data: []byte("{{.Quote}}")},
+	}
+
+	tpl, err := mail.NewTemplateFS(fsys, "welcome/topic.tmpl", "welcome/body.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(testData{Name: "Ava", Quote: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Topic != "Welcome Ava" || msg.Body != "Hi" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	_, err = mail.NewTemplateFS(fsys, "welcome/topic.tmpl", "welcome/missing.tmpl")
+	if err == nil {
+		t.Fatal("expected error for missing body template")
+	}
+}
+
+func TestWithPartials(t *testing.T) {
+	tpl, err := mail.NewTemplate(
+		"Hello {{.Name}}",
+		`{{template "header" .}}{{.Quote}}{{template "footer" .}}`,
+		mail.WithPartials(map[string]string{
+			"header": "Dear {{.Name}},\n",
+			"footer": "\nBye",
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(testData{Name: "Ava", Quote: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Body != "Dear Ava,\nHi\nBye" {
+		t.Fatalf("unexpected body: %q", msg.Body)
+	}
+
+	_, err = mail.NewTemplate("", "", mail.WithPartials(map[string]string{
+		"broken": "{{.Name",
+	}))
+	if err == nil || !strings.Contains(err.Error(), `"broken"`) {
+		t.Fatalf("expected error naming broken partial, got: %v", err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		options []mail.Option
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "link",
+			body: "[{{.Name}}](https://example.de)",
+			want: []string{`<a href="https://example.de">Ava</a>`},
+		},
+		{
+			name: "list",
+			body: "- one\n- two\n",
+			want: []string{"<ul>", "<li>one</li>", "<li>two</li>"},
+		},
+		{
+			name: "code block",
+			body: "```\nfmt.Println(1)\n```\n",
+			want: []string{"<pre><code>fmt.Println(1)\n</code></pre>"},
+		},
+		{
+			name:    "raw html is omitted",
+			body:    "<b>bold</b>",
+			notWant: []string{"<b>"},
+		},
+		{
+			name:    "raw html with unsafe",
+			body:    "<b>bold</b>",
+			options: []mail.Option{mail.MarkdownUnsafe()},
+			want:    []string{"<b>bold</b>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]mail.Option{mail.Markdown()}, tt.options...)
+			tpl, err := mail.NewTemplate("topic", tt.body, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := tpl.Execute(testData{Name: "Ava"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if msg.ContentType != "text/html" {
+				t.Errorf("expected content-type text/html, got %v", msg.ContentType)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(msg.Body, want) {
+					t.Errorf("expected %q in body: %q", want, msg.Body)
+				}
+			}
+
+			for _, notWant := range tt.notWant {
+				if strings.Contains(msg.Body, notWant) {
+					t.Errorf("didn't expect %q in body: %q", notWant, msg.Body)
+				}
+			}
+		})
+	}
+}
+
+var pngContent = []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0dIHDR\x00\x00\x00\x01")
+
+func TestExecuteDecodesAttachments(t *testing.T) {
+	tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments("image/png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(nil, mail.WithAttachments(mail.RequestAttachments{
+		{Name: "logo", Content: base64.StdEncoding.EncodeToString(pngContent)},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("expected one attachment, got %v", len(msg.Attachments))
+	}
+
+	a := msg.Attachments[0]
+	if a.Kind != "image/png" {
+		t.Errorf("expected kind image/png, got %v", a.Kind)
+	}
+
+	if !bytes.Equal(a.Content, pngContent) {
+		t.Errorf("expected decoded content %q, got %q", pngContent, a.Content)
+	}
+
+	_, err = tpl.Execute(nil, mail.WithAttachments(mail.RequestAttachments{
+		{Name: "logo", Content: "not base64!"},
+	}))
+	if err == nil {
+		t.Fatal("expected error for invalid base64 content")
+	}
+}
+
+func TestRequestAttachmentDecode(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(pngContent)
+	tests := map[string]string{
+		"padded":       encoded,
+		"unpadded":     strings.TrimRight(encoded, "="),
+		"line wrapped": encoded[:8] + "\r\n" + encoded[8:16] + "\n " + encoded[16:],
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			raw, err := mail.RequestAttachment{Name: "logo", Content: content}.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(raw.Content, pngContent) {
+				t.Errorf("expected decoded content %q, got %q", pngContent, raw.Content)
+			}
+		})
+	}
+}
+
+func TestExecuteRawAttachments(t *testing.T) {
+	tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments("image/png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(nil, mail.WithRawAttachments(mail.RawAttachment{
+		Name:    "logo",
+		Content: pngContent,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msg.Attachments) != 1 || !bytes.Equal(msg.Attachments[0].Content, pngContent) {
+		t.Fatalf("expected raw attachment to be kept, got %+v", msg.Attachments)
+	}
+}
+
+func TestMaxAttachmentSize(t *testing.T) {
+	tpl, err := mail.NewTemplate("topic", "body",
+		mail.AllowAttachments("image/png"),
+		mail.MaxAttachmentSize(int64(len(pngContent))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := base64.StdEncoding.EncodeToString(pngContent)
+	_, err = tpl.Execute(nil, mail.WithAttachments(mail.RequestAttachments{
+		{Name: "logo", Content: content},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooBig := base64.StdEncoding.EncodeToString(append(pngContent, 0))
+	_, err = tpl.Execute(nil, mail.WithAttachments(mail.RequestAttachments{
+		{Name: "logo", Content: content},
+		{Name: "big-logo", Content: tooBig},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "big-logo") {
+		t.Fatalf("expected error naming big-logo, got: %v", err)
+	}
+
+	_, err = tpl.Execute(nil, mail.WithRawAttachments(mail.RawAttachment{
+		Name:    "raw-logo",
+		Content: append(pngContent, 0),
+	}))
+	if err == nil || !strings.Contains(err.Error(), "raw-logo") {
+		t.Fatalf("expected error naming raw-logo, got: %v", err)
+	}
+}
+
+func TestMaxAttachments(t *testing.T) {
+	content := base64.StdEncoding.EncodeToString(pngContent)
+	attachments := mail.RequestAttachments{
+		{Name: "logo", Content: content},
+		{Name: "logo-2", Content: content},
+	}
+
+	tests := []struct {
+		name    string
+		options []mail.Option
+		wantErr bool
+	}{
+		{name: "unlimited"},
+		{name: "within limit", options: []mail.Option{mail.MaxAttachments(2)}},
+		{name: "exceeds limit", options: []mail.Option{mail.MaxAttachments(1)}, wantErr: true},
+		{name: "none allowed", options: []mail.Option{mail.MaxAttachments(0)}, wantErr: true},
+		{name: "negative is unlimited", options: []mail.Option{mail.MaxAttachments(-1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]mail.Option{mail.AllowAttachments("image/png")}, tt.options...)
+			tpl, err := mail.NewTemplate("topic", "body", options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = tpl.Execute(nil, mail.WithAttachments(attachments))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewMultipartTemplate(t *testing.T) {
+	tpl, err := mail.NewMultipartTemplate(
+		"Hello {{.Name}}",
+		"{{.Quote}}",
+		"<p>{{.Quote}}</p>",
+		mail.ContentType("text/html"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(testData{Name: "Ava", Quote: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Body != "Hi" || msg.ContentType != "text/plain" {
+		t.Errorf("expected plain text body, got %q (%v)", msg.Body, msg.ContentType)
+	}
+
+	want := []mail.Alternative{{ContentType: "text/html", Body: "<p>Hi</p>"}}
+	if len(msg.Alternatives) != 1 || msg.Alternatives[0] != want[0] {
+		t.Errorf("expected alternatives %+v, got %+v", want, msg.Alternatives)
+	}
+
+	_, err = mail.NewMultipartTemplate("topic", "text", "<p>html</p>", mail.Markdown())
+	if err == nil {
+		t.Fatal("expected error for markdown in multipart template")
+	}
+}
+
+func TestNewTemplateFiles(t *testing.T) {
+	dir := t.TempDir()
+	topicPath := filepath.Join(dir, "topic.tmpl")
+	bodyPath := filepath.Join(dir, "body.tmpl")
+
+	if err := os.WriteFile(topicPath, []byte("Welcome {{.Name}}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bodyPath, []byte("{{.Quote}}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := mail.NewTemplateFiles(topicPath, bodyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(testData{Name: "Ava", Quote: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Topic != "Welcome Ava" || msg.Body != "Hi" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	_, err = mail.NewTemplateFiles(filepath.Join(dir, "missing.tmpl"), bodyPath)
+	if err == nil || !strings.Contains(err.Error(), "topic") {
+		t.Fatalf("expected error for missing topic template, got: %v", err)
+	}
+}
+
+func TestStrictTemplates(t *testing.T) {
+	data := map[string]string{"Name": "Ava"}
+
+	tpl, err := mail.NewTemplate("Hi {{.Name}}", "Your order {{.Order}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Body != "Your order " {
+		t.Errorf("expected lenient template to render empty value, got %q", msg.Body)
+	}
+
+	tpl, err = mail.NewTemplate("Hi {{.Name}}", "Your order {{.Order}}", mail.StrictTemplates())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tpl.Execute(data)
+	if err == nil || !strings.Contains(err.Error(), `"Order"`) {
+		t.Errorf("expected error naming missing key, got: %v", err)
+	}
+
+	tpl, err = mail.NewTemplate("Hi {{.Missing}}", "Hi", mail.StrictTemplates())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tpl.Execute(testData{Name: "Ava"})
+	if err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Errorf("expected error naming missing field in subject, got: %v", err)
+	}
+
+	tpl, err = mail.NewTemplate("", `{{template "footer" .}}`, mail.StrictTemplates(), mail.WithPartials(map[string]string{
+		"footer": "{{.Signature}}",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = tpl.Execute(data); err == nil {
+		t.Error("expected error for missing key in partial")
+	}
+}
+
+func TestMustTemplate(t *testing.T) {
+	tpl := mail.MustTemplate("Hi {{.Name}}", "Body")
+	msg, err := tpl.Execute(testData{Name: "Ava"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Topic != "Hi Ava" {
+		t.Errorf("unexpected topic: %q", msg.Topic)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for broken template")
+		}
+	}()
+	mail.MustTemplate("{{.Name", "")
+}
+
+func TestMessageValidate(t *testing.T) {
+	valid := mail.Message{
+		Topic:        "topic",
+		Body:         "Hi",
+		ContentType:  "text/plain; charset=UTF-8",
+		Alternatives: []mail.Alternative{{ContentType: "text/html", Body: "<p>Hi</p>"}},
+		Attachments:  []mail.Attachment{{Name: "logo", Kind: "image/png", Content: pngContent}},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid message, got: %v", err)
+	}
+
+	tests := map[string]func(m *mail.Message){
+		"topic":        func(m *mail.Message) { m.Topic = "" },
+		"contentType":  func(m *mail.Message) { m.ContentType = "application/json" },
+		"alternatives": func(m *mail.Message) { m.Alternatives = []mail.Alternative{{ContentType: "text/markdown"}} },
+		"name":         func(m *mail.Message) { m.Attachments = []mail.Attachment{{Kind: "image/png", Content: pngContent}} },
+		"content":      func(m *mail.Message) { m.Attachments = []mail.Attachment{{Name: "logo", Kind: "image/png"}} },
+		"kind": func(m *mail.Message) {
+			m.Attachments = []mail.Attachment{{Name: "logo", Kind: "no type", Content: pngContent}}
+		},
+	}
+
+	for field, broken := range tests {
+		m := valid
+		broken(&m)
+
+		err := m.Validate()
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("expected error for %v, got: %v", field, err)
+		}
+	}
+}
+
+func TestAllowAttachmentsWildcards(t *testing.T) {
+	pdfContent := []byte("%PDF-1.4\n%test")
+
+	tests := []struct {
+		allowed []string
+		content []byte
+		ok      bool
+	}{
+		{allowed: []string{"image/*"}, content: pngContent, ok: true},
+		{allowed: []string{"image/*"}, content: pdfContent, ok: false},
+		{allowed: []string{"image/*", "application/pdf"}, content: pdfContent, ok: true},
+		{allowed: []string{"*/*"}, content: pdfContent, ok: true},
+		{allowed: []string{"text/plain"}, content: []byte("plain text"), ok: true},
+		{allowed: []string{"text/*"}, content: pngContent, ok: false},
+	}
+
+	for _, test := range tests {
+		tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments(test.allowed...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tpl.Execute(nil, mail.WithRawAttachments(mail.RawAttachment{Name: "file", Content: test.content}))
+		if (err == nil) != test.ok {
+			t.Errorf("allowed %v: expected ok %v, got err: %v", test.allowed, test.ok, err)
+		}
+	}
+}
+
+func TestRequestAttachmentKind(t *testing.T) {
+	csv := base64.StdEncoding.EncodeToString([]byte("a,b\n1,2\n"))
+
+	tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments("text/csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(nil, mail.WithAttachments(mail.RequestAttachments{
+		{Name: "report", Content: csv, Kind: "text/csv"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Attachments[0].Kind != "text/csv" {
+		t.Errorf("expected declared kind to be used, got %v", msg.Attachments[0].Kind)
+	}
+
+	_, err = tpl.Execute(nil, mail.WithAttachments(mail.RequestAttachments{{Name: "report", Content: csv}}))
+	if err == nil {
+		t.Error("expected detected text/plain to be rejected")
+	}
+
+	_, err = tpl.Execute(nil, mail.WithAttachments(mail.RequestAttachments{{Name: "report", Content: csv, Kind: "image/svg+xml"}}))
+	if err == nil {
+		t.Error("expected declared kind to be checked against allowed types")
+	}
+
+	_, err = tpl.Execute(nil, mail.WithRawAttachments(mail.RawAttachment{Name: "report", Content: []byte("a"), Kind: "not a type"}))
+	if err == nil {
+		t.Error("expected error for invalid kind")
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	tpl, err := mail.NewTemplate("Welcome {{.Name}}", strings.Repeat("Hello {{.Name}}, thanks for signing up.\n", 50))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	data := map[string]string{"Name": "Ava"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tpl.Execute(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	content := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 7500)
+	attachments := mail.WithRawAttachments(mail.RawAttachment{Name: "logo", Content: content, Kind: "image/png"})
+
+	tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments("image/png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(nil, attachments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := msg.EstimatedSize()
+	if size < int64(len(content))*4/3 {
+		t.Errorf("expected the base64 encoding to be included, got %d for %d bytes", size, len(content))
+	}
+
+	path := filepath.Join(t.TempDir(), "message.eml")
+	if err = mail.WriteEML(path, "test@example.de", mail.To{"ava@example.de"}, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := info.Size(); size < actual || size > actual*11/10 {
+		t.Errorf("expected estimated size %d to be close above the actual size %d", size, actual)
+	}
+
+	for limit, ok := range map[int64]bool{size: true, size + 1: true, size - 1: false} {
+		_, err = tpl.Execute(nil, attachments, mail.MaxMessageSize(limit))
+		if ok && err != nil {
+			t.Errorf("expected message within %d bytes, got %v", limit, err)
+		}
+
+		if !ok && (err == nil || !strings.Contains(err.Error(), "too large")) {
+			t.Errorf("expected message too large for %d bytes, got %v", limit, err)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	data := map[string]string{"Name": "Ben", "Agent": "Ava <Support>"}
+
+	tpl, err := mail.NewTemplate("topic", "Hello {{.Name}}\n", mail.Signature("{{.Agent}}\nAcme Support"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "Hello Ben\n\n-- \nAva <Support>\nAcme Support"; msg.Body != want {
+		t.Errorf("expected signature after separator %q, got %q", want, msg.Body)
+	}
+
+	tpl, err = mail.NewTemplate("topic", "<html><body><p>Hello {{.Name}}</p></body></html>",
+		mail.ContentType("text/html"), mail.Signature("<p>{{.Agent}}</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = tpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<html><body><p>Hello Ben</p><p>Ava &lt;Support&gt;</p></body></html>"; msg.Body != want {
+		t.Errorf("expected signature inside the body %q, got %q", want, msg.Body)
+	}
+
+	tpl, err = mail.NewMultipartTemplate("topic", "Hello {{.Name}}", "<p>Hello {{.Name}}</p>", mail.Signature("{{.Agent}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = tpl.Execute(data, mail.Signature("Regards {{.Agent}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(msg.Body, "-- \nRegards Ava <Support>") || msg.Alternatives[0].Body != "<p>Hello Ben</p>Regards Ava &lt;Support&gt;" {
+		t.Errorf("expected signature of the execute option in both bodies, got %q and %q", msg.Body, msg.Alternatives[0].Body)
+	}
+
+	if _, err = mail.NewTemplate("topic", "body", mail.Signature("{{.Agent")); err == nil {
+		t.Error("expected error for invalid signature")
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	tpl, err := mail.NewTemplate("{{.Product}}: {{.Subject}}", "Hi {{.Name}}, © {{.Year}} {{.Product}}",
+		mail.WithDefaults(map[string]interface{}{"Product": "Acme", "Year": 2024, "Subject": "News"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type base struct {
+		Name string
+	}
+	data := struct {
+		base
+		Subject string
+		secret  string
+	}{base: base{Name: "Ava"}, Subject: "Invoice", secret: "hidden"}
+
+	msg, err := tpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Topic != "Acme: Invoice" || msg.Body != "Hi Ava, © 2024 Acme" {
+		t.Errorf("unexpected message %q: %q", msg.Topic, msg.Body)
+	}
+
+	msg, err = tpl.Execute(map[string]interface{}{"Name": "Ben", "Year": 2025}, mail.WithDefaults(map[string]interface{}{"Product": "Acme Billing"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Topic != "Acme Billing: News" || msg.Body != "Hi Ben, © 2025 Acme Billing" {
+		t.Errorf("unexpected message %q: %q", msg.Topic, msg.Body)
+	}
+
+	if msg, err = tpl.Execute(nil); err != nil || msg.Topic != "Acme: News" {
+		t.Errorf("expected defaults for nil data, got %q: %v", msg.Topic, err)
+	}
+
+	if _, err = tpl.Execute("Ava"); err == nil {
+		t.Error("expected error for data which can't be merged")
+	}
+}
+
+func TestExecuteContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	tpl, err := mail.NewTemplate("topic", "{{lookup .}}", mail.TemplateFuncs(map[string]interface{}{
+		"lookup": func(name string) string {
+			if name == "slow" {
+				<-release
+			}
+			return "hello " + name
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.ExecuteContext(context.Background(), "Ava")
+	if err != nil || msg.Body != "hello Ava" {
+		t.Fatalf("unexpected body %q: %v", msg.Body, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err = tpl.ExecuteContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got: %v", err)
+	}
+
+	if _, err = tpl.ExecuteContext(ctx, "Ava"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error of done context, got: %v", err)
+	}
+}
+
+func TestVerifyAttachmentType(t *testing.T) {
+	zip := []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")
+	pdf := []byte("%PDF-1.4\n%âãÏÓ\n")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	tests := []struct {
+		name       string
+		attachment mail.RawAttachment
+		wantErr    bool
+	}{
+		{"pdf", mail.RawAttachment{Name: "report.pdf", Content: pdf, Kind: "application/pdf"}, false},
+		{"zip as pdf", mail.RawAttachment{Name: "report.pdf", Content: zip, Kind: "application/pdf"}, true},
+		{"zip with pdf extension", mail.RawAttachment{Name: "report.pdf", Content: zip}, true},
+		{"png as jpeg", mail.RawAttachment{Name: "logo", Content: png, Kind: "image/jpeg"}, true},
+		{"docx", mail.RawAttachment{Name: "letter.docx", Content: zip, Kind: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"}, false},
+		{"csv", mail.RawAttachment{Name: "list.csv", Content: []byte("name,email\nAva,ava@example.de\n"), Kind: "text/csv"}, false},
+		{"unknown content", mail.RawAttachment{Name: "data.bin", Content: []byte{0, 1, 2, 3}, Kind: "application/x-custom"}, false},
+		{"unknown content as png", mail.RawAttachment{Name: "logo.png", Content: []byte{0, 1, 2, 3}, Kind: "image/png"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tpl := mail.MustTemplate("topic", "body", mail.AllowAttachments("*/*"), mail.VerifyAttachmentType())
+
+			_, err := tpl.Execute(nil, mail.WithRawAttachments(test.attachment))
+			if (err != nil) != test.wantErr {
+				t.Errorf("expected error %v, got: %v", test.wantErr, err)
+			}
+		})
+	}
+
+	tpl := mail.MustTemplate("topic", "body", mail.AllowAttachments("*/*"))
+	if _, err := tpl.Execute(nil, mail.WithRawAttachments(mail.RawAttachment{Name: "report.pdf", Content: zip, Kind: "application/pdf"})); err != nil {
+		t.Errorf("expected mismatched attachment without VerifyAttachmentType, got: %v", err)
+	}
+
+	tpl = mail.MustTemplate("topic", "body", mail.AllowAttachments("*/*"), mail.VerifyAttachmentType(),
+		mail.ReaderAttachment("report.pdf", bytes.NewReader(zip), "application/pdf"),
+	)
+	if _, err := tpl.Execute(nil); err == nil || !strings.Contains(err.Error(), "application/zip") {
+		t.Errorf("expected error for streamed zip as pdf, got: %v", err)
+	}
+}
+
+func TestPlainTextUnescaped(t *testing.T) {
+	data := map[string]string{"Company": "Smith & Sons <Ltd>", "Formula": "a < b && c > d"}
+
+	tpl, err := mail.NewTemplate("Offer of {{.Company}}", `{{if .Formula}}{{template "formula" .}}{{end}} & 1 < 2, {{.Missing}}done`,
+		mail.WithPartials(map[string]string{"formula": "Formula: {{.Formula}}"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Topic != "Offer of Smith & Sons <Ltd>" {
+		t.Errorf("expected unescaped subject, got %q", msg.Topic)
+	}
+
+	if want := "Formula: a < b && c > d & 1 < 2, done"; msg.Body != want {
+		t.Errorf("expected unescaped plain text body %q, got %q", want, msg.Body)
+	}
+
+	tpl, err = mail.NewMultipartTemplate("Offer of {{.Company}}", "{{.Company}}", "<p>{{.Company}}</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = tpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Body != "Smith & Sons <Ltd>" || msg.Alternatives[0].Body != "<p>Smith &amp; Sons &lt;Ltd&gt;</p>" {
+		t.Errorf("expected only the html body to be escaped, got %q and %q", msg.Body, msg.Alternatives[0].Body)
+	}
+
+	tpl, err = mail.NewTemplate("topic", "<p>{{.Company}}</p>", mail.ContentType("text/html; charset=utf-8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg, err = tpl.Execute(data); err != nil || msg.Body != "<p>Smith &amp; Sons &lt;Ltd&gt;</p>" {
+		t.Errorf("expected escaped html body, got %q: %v", msg.Body, err)
+	}
+}
+
+func TestExecuteContentTypeSwitch(t *testing.T) {
+	tpl, err := mail.NewTemplate("topic", "<p>{{.}}</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, option := range map[string]mail.Option{
+		"html":     mail.ContentType("text/html"),
+		"markdown": mail.Markdown(),
+	} {
+		if msg, err := tpl.Execute("<script>x</script>", option); err == nil {
+			t.Errorf("%v: expected error instead of unescaped body %q", name, msg.Body)
+		}
+	}
+
+	if _, err = tpl.Execute("x", mail.ContentType("text/plain; charset=utf-8")); err != nil {
+		t.Errorf("expected plain text content type to be allowed: %v", err)
+	}
+
+	tpl, err = mail.NewMultipartTemplate("topic", "a {{.}}", "<p>{{.}}</p>", mail.ContentType("text/html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := tpl.Execute("<b>&</b>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.ContentType != "text/plain" || msg.Body != "a <b>&</b>" {
+		t.Errorf("expected unescaped text/plain body, got %v %q", msg.ContentType, msg.Body)
+	}
+}
+
+func TestAllowedAttachmentTypes(t *testing.T) {
+	tpl := mail.MustTemplate("topic", "body", mail.AllowAttachments("image/*", "application/pdf", "text/csv"))
+
+	types := tpl.AllowedAttachmentTypes()
+	if want := []string{"application/pdf", "image/*", "text/csv"}; strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, types)
+	}
+
+	types[0] = "*/*"
+	if _, err := tpl.Execute(nil, mail.WithRawAttachments(mail.RawAttachment{Name: "data.zip", Content: []byte("PK\x03\x04"), Kind: "application/zip"})); err == nil {
+		t.Error("expected the returned types to be a copy")
+	}
+
+	if types := mail.MustTemplate("topic", "body").AllowedAttachmentTypes(); len(types) != 0 {
+		t.Errorf("expected no allowed types, got %v", types)
+	}
+}
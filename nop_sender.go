@@ -0,0 +1,28 @@
+package mail
+
+import (
+	"context"
+)
+
+// NopSender accepts every mail and discards it, e.g. for load tests. It's the
+// counterpart of MemRecorder when the mails don't need to be recorded.
+type NopSender struct{}
+
+var _ ConfigurableSender = NopSender{}
+
+func (NopSender) Send(from string, to To, message Message, options ...SendOption) error {
+	return nil
+}
+
+// SendContext discards the mail and returns the Message-ID set with Header or a generated one
+func (NopSender) SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error) {
+	opts := sendOptions{}
+	for _, option := range options {
+		option.apply(&opts)
+	}
+
+	return opts.messageID(TxConfig{}.messageIDDomain(from)), nil
+}
+
+// UpdateTxConfig does nothing
+func (NopSender) UpdateTxConfig(cfg TxConfig) {}
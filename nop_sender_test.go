@@ -0,0 +1,30 @@
+package mail_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestNopSender(t *testing.T) {
+	var sender mail.ConfigurableSender = mail.NopSender{}
+	sender.UpdateTxConfig(mail.TxConfig{Host: "localhost"})
+
+	if err := sender.Send("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := sender.SendContext(context.Background(), "test@example.de", nil, mail.Message{}, mail.Header("Message-Id", "<1@example.de>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != "<1@example.de>" {
+		t.Errorf("expected Message-ID of header, got %q", id)
+	}
+
+	if id, _ = sender.SendContext(context.Background(), "test@example.de", nil, mail.Message{}); id == "" {
+		t.Error("expected generated Message-ID")
+	}
+}
@@ -0,0 +1,166 @@
+package mail
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// outgoingJSON is the stored form of Outgoing
+type outgoingJSON struct {
+	From    string         `json:"from,omitempty"`
+	To      To             `json:"to"`
+	Message Message        `json:"message"`
+	Options *storedOptions `json:"options,omitempty"`
+}
+
+// storedOptions are the send options resolved to values which can be stored
+type storedOptions struct {
+	AsCc                  bool                `json:"asCc,omitempty"`
+	Cc                    []string            `json:"cc,omitempty"`
+	Bcc                   []string            `json:"bcc,omitempty"`
+	ReplyTo               []string            `json:"replyTo,omitempty"`
+	Headers               map[string][]string `json:"headers,omitempty"`
+	SkipAddressValidation bool                `json:"skipAddressValidation,omitempty"`
+	ValidateMessage       bool                `json:"validateMessage,omitempty"`
+	Normalize             bool                `json:"normalize,omitempty"`
+	Date                  *time.Time          `json:"date,omitempty"`
+	ReturnPath            string              `json:"returnPath,omitempty"`
+	Sender                string              `json:"sender,omitempty"`
+	RetryAttempts         int                 `json:"retryAttempts,omitempty"`
+	RetryBackoff          time.Duration       `json:"retryBackoff,omitempty"`
+}
+
+func newStoredOptions(options []SendOption) (stored *storedOptions, err error) {
+	opts := sendOptions{}
+	for _, option := range options {
+		option.apply(&opts)
+	}
+
+	if opts.err != nil {
+		err = opts.err
+		return
+	}
+
+	stored = &storedOptions{
+		AsCc:                  opts.asCc,
+		Cc:                    opts.cc,
+		Bcc:                   opts.bcc,
+		ReplyTo:               opts.replyTo,
+		Headers:               opts.headers,
+		SkipAddressValidation: opts.skipAddressValidation,
+		ValidateMessage:       opts.validateMessage,
+		Normalize:             opts.normalize,
+		ReturnPath:            opts.returnPath,
+		Sender:                opts.sender,
+		RetryAttempts:         opts.retryAttempts,
+		RetryBackoff:          opts.retryBackoff,
+	}
+
+	if !opts.date.IsZero() {
+		stored.Date = &opts.date
+	}
+
+	return
+}
+
+// options returns the send options which restore the stored ones
+func (s *storedOptions) options() (options []SendOption) {
+	if s.AsCc {
+		options = append(options, AsCc())
+	}
+
+	if len(s.Cc) > 0 {
+		options = append(options, Cc(s.Cc...))
+	}
+
+	if len(s.Bcc) > 0 {
+		options = append(options, Bcc(s.Bcc...))
+	}
+
+	if len(s.ReplyTo) > 0 {
+		options = append(options, ReplyTo(s.ReplyTo...))
+	}
+
+	keys := make([]string, 0, len(s.Headers))
+	for key := range s.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		options = append(options, Header(key, s.Headers[key]...))
+	}
+
+	if s.SkipAddressValidation {
+		options = append(options, SkipAddressValidation())
+	}
+
+	if s.ValidateMessage {
+		options = append(options, ValidateMessage())
+	}
+
+	if s.Normalize {
+		options = append(options, NormalizeRecipients())
+	}
+
+	if s.Date != nil {
+		options = append(options, Date(*s.Date))
+	}
+
+	if s.ReturnPath != "" {
+		options = append(options, ReturnPath(s.ReturnPath))
+	}
+
+	if s.Sender != "" {
+		options = append(options, WithSender(s.Sender))
+	}
+
+	if s.RetryAttempts != 0 || s.RetryBackoff != 0 {
+		options = append(options, Retry(s.RetryAttempts, s.RetryBackoff))
+	}
+
+	return
+}
+
+// MarshalJSON stores the options as the values they set. Invalid options and
+// attachments which are streamed when sent, e.g. a FileAttachment, can't be stored.
+func (o Outgoing) MarshalJSON() ([]byte, error) {
+	for _, a := range o.Message.Attachments {
+		if a.Open != nil && len(a.Content) == 0 {
+			return nil, fmt.Errorf("couldn't store attachment %v: streamed attachments can't be stored", a.Name)
+		}
+	}
+
+	stored, err := newStoredOptions(o.Options)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't store send options: %v", err)
+	}
+
+	return json.Marshal(outgoingJSON{
+		From:    o.From,
+		To:      o.To,
+		Message: o.Message,
+		Options: stored,
+	})
+}
+
+// UnmarshalJSON restores an Outgoing stored with MarshalJSON
+func (o *Outgoing) UnmarshalJSON(data []byte) error {
+	var stored outgoingJSON
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	*o = Outgoing{
+		From:    stored.From,
+		To:      stored.To,
+		Message: stored.Message,
+	}
+
+	if stored.Options != nil {
+		o.Options = stored.Options.options()
+	}
+
+	return nil
+}
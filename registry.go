@@ -0,0 +1,50 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTemplateNotFound is returned by Registry.Execute for unknown template names
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Registry holds named templates, which can be looked up concurrently.
+// The zero value is an empty registry ready to use.
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]Template
+}
+
+// Register adds tpl with name, a template registered with the same name before is replaced
+func (r *Registry) Register(name string, tpl Template) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.templates == nil {
+		r.templates = map[string]Template{}
+	}
+
+	r.templates[name] = tpl
+}
+
+// Lookup returns the template registered with name
+func (r *Registry) Lookup(name string) (tpl Template, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tpl, ok = r.templates[name]
+	return
+}
+
+// Execute executes the template registered with name, see Template.Execute.
+// The error wraps ErrTemplateNotFound when no template is registered with name.
+func (r *Registry) Execute(name string, data interface{}, opts ...Option) (msg Message, err error) {
+	tpl, ok := r.Lookup(name)
+	if !ok {
+		err = fmt.Errorf("%w: %v", ErrTemplateNotFound, name)
+		return
+	}
+
+	return tpl.Execute(data, opts...)
+}
@@ -0,0 +1,88 @@
+package mail_test
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestRegistry(t *testing.T) {
+	var registry mail.Registry
+
+	welcome, err := mail.NewTemplate("Welcome {{.Name}}", "Hello {{.Name}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Register("welcome", welcome)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if i%2 == 0 {
+				registry.Register(fmt.Sprintf("other-%v", i), welcome)
+				return
+			}
+
+			msg, err := registry.Execute("welcome", map[string]string{"Name": "Ava"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if msg.Topic != "Welcome Ava" || msg.Body != "Hello Ava" {
+				t.Errorf("unexpected message: %+v", msg)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, ok := registry.Lookup("other-4"); !ok {
+		t.Error("expected registered template")
+	}
+
+	_, err = registry.Execute("missing", nil)
+	if !errors.Is(err, mail.ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestRegistryExecuteParseOptions(t *testing.T) {
+	var registry mail.Registry
+
+	welcome, err := mail.NewTemplate("Welcome", "{{number .}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Register("welcome", welcome)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := registry.Execute("welcome", 1.5, mail.Locale("en"), mail.TemplateFuncs(template.FuncMap{"shout": strings.ToUpper}))
+			if err == nil {
+				t.Error("expected error for parse options passed to Execute")
+			}
+		}()
+	}
+	wg.Wait()
+
+	msg, err := registry.Execute("welcome", 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Body != "1,5" {
+		t.Errorf("expected the locale of the registered template, got %q", msg.Body)
+	}
+}
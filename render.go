@@ -0,0 +1,269 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	stdmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/mail.v2"
+)
+
+// newMessage assembles the message as it is transmitted
+func newMessage(
+	from string,
+	to To,
+	message Message,
+	domain string,
+	options []SendOption,
+) (m *mail.Message, err error) {
+	if from == "" {
+		err = errors.New("from cannot be empty")
+		return
+	}
+
+	opts := sendOptions{}
+	for _, o := range options {
+		o.apply(&opts)
+	}
+
+	if opts.err != nil {
+		err = opts.err
+		return
+	}
+
+	if opts.normalize {
+		to = opts.normalizeRecipients(to)
+	}
+
+	if len(to)+len(opts.cc)+len(opts.bcc) == 0 {
+		err = errors.New("at least one 'to', 'cc' or 'bcc' email-address must be given")
+		return
+	}
+
+	if !opts.skipAddressValidation {
+		if err = validateAddresses(from, to, opts); err != nil {
+			return
+		}
+	}
+
+	if opts.validateMessage {
+		if err = message.Validate(); err != nil {
+			err = fmt.Errorf("invalid message: %v", err)
+			return
+		}
+	}
+
+	var settings []mail.MessageSetting
+	if !isUTF8(message.Charset) {
+		if message, err = encodeCharset(message); err != nil {
+			return
+		}
+		settings = append(settings, mail.SetCharset(message.Charset))
+	}
+	if message.Encoding != "" {
+		settings = append(settings, mail.SetEncoding(mail.Encoding(message.Encoding)))
+	}
+
+	m = mail.NewMessage(settings...)
+
+	m.SetHeader("From", formatAddresses(from)...)
+	if opts.sender != "" && !strings.EqualFold(bareAddress(opts.sender), bareAddress(from)) {
+		m.SetHeader("Sender", formatAddresses(opts.sender)...)
+	}
+	to, cc := opts.headerRecipients(to)
+
+	if len(to) > 0 {
+		m.SetHeader("To", formatAddresses(to...)...)
+	} else {
+		// an empty group, so the Cc and Bcc recipients are not disclosed
+		m.SetHeader("To", undisclosedRecipients)
+	}
+	if len(cc) > 0 {
+		m.SetHeader("Cc", formatAddresses(cc...)...)
+	}
+	if len(opts.bcc) > 0 {
+		m.SetHeader("Bcc", formatAddresses(opts.bcc...)...)
+	}
+	m.SetHeader("Subject", message.Topic)
+	if len(opts.replyTo) > 0 {
+		m.SetHeader("Reply-To", formatAddresses(opts.replyTo...)...)
+	}
+	if opts.returnPath != "" {
+		m.SetHeader("Return-Path", "<"+opts.returnPath+">")
+	}
+	if !opts.date.IsZero() {
+		m.SetDateHeader("Date", opts.date)
+	}
+	for key, values := range opts.headers {
+		m.SetHeader(key, values...)
+	}
+	m.SetHeader("Message-Id", opts.messageID(domain))
+	m.SetBody(message.ContentType, message.Body)
+	for _, alt := range message.Alternatives {
+		m.AddAlternative(alt.ContentType, alt.Body)
+	}
+
+	for _, a := range message.Attachments {
+		var filename string
+		filename, err = attachmentFilename(a)
+		if err != nil {
+			return
+		}
+
+		attachFromMemory(m, filename, a)
+	}
+
+	return
+}
+
+// undisclosedRecipients is the To header of messages only sent to Cc or Bcc recipients
+const undisclosedRecipients = "Undisclosed recipients:;"
+
+// envelope returns the envelope sender and recipients of m, like mail.Send
+// but To, Cc and Bcc can contain groups like undisclosedRecipients.
+func envelope(m *mail.Message) (from string, to []string, err error) {
+	sender := m.GetHeader("Sender")
+	if len(sender) == 0 {
+		sender = m.GetHeader("From")
+	}
+	if len(sender) == 0 {
+		err = errors.New("message has no From header")
+		return
+	}
+
+	addr, err := stdmail.ParseAddress(sender[0])
+	if err != nil {
+		err = fmt.Errorf("invalid address %q: %v", sender[0], err)
+		return
+	}
+	from = addr.Address
+
+	seen := map[string]struct{}{}
+	for _, field := range []string{"To", "Cc", "Bcc"} {
+		for _, value := range m.GetHeader(field) {
+			var list []*stdmail.Address
+			list, err = stdmail.ParseAddressList(value)
+			if err != nil {
+				err = fmt.Errorf("invalid address %q: %v", value, err)
+				return
+			}
+
+			for _, addr := range list {
+				if _, ok := seen[addr.Address]; !ok {
+					seen[addr.Address] = struct{}{}
+					to = append(to, addr.Address)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// WriteEML writes message as .eml file to path like it would be sent, parent directories are created.
+// The Message-ID domain is localhost, set the Message-Id header for another one.
+func WriteEML(path string, from string, to To, message Message, options ...SendOption) (err error) {
+	m, err := newMessage(from, to, message, TxConfig{}.messageIDDomain(from), options)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err = m.WriteTo(&buf); err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("couldn't create directory of eml file: %v", err)
+	}
+
+	if err = os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("couldn't write eml file: %v", err)
+	}
+
+	return nil
+}
+
+// envelopeFrom returns the address of the Return-Path header of msg, when it's set, or from
+func envelopeFrom(msg io.WriterTo, from string) string {
+	m, ok := msg.(*mail.Message)
+	if !ok {
+		return from
+	}
+
+	if returnPath := m.GetHeader("Return-Path"); len(returnPath) > 0 {
+		if addr := strings.Trim(returnPath[0], "<> "); addr != "" {
+			return addr
+		}
+	}
+
+	return from
+}
+
+// headerRecipients returns the recipients of the To and Cc headers, with AsCc all but the first to are cc
+func (o *sendOptions) headerRecipients(to To) (To, []string) {
+	if !o.asCc || len(to) == 0 {
+		return to, o.cc
+	}
+
+	return to[:1], append(append([]string{}, to[1:]...), o.cc...)
+}
+
+// attachFromMemory attaches or embeds the content of a without writing it to disk
+func attachFromMemory(m *mail.Message, filename string, a Attachment) {
+	settings := []mail.FileSetting{
+		mail.SetCopyFunc(func(w io.Writer) error {
+			if a.Open == nil {
+				_, err := w.Write(a.Content)
+				return err
+			}
+
+			rc, err := a.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+
+			_, err = io.Copy(w, rc)
+			return err
+		}),
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(a.Kind); err == nil {
+		settings = append(settings, mail.SetHeader(map[string][]string{
+			"Content-Type": {mime.FormatMediaType(mediaType, map[string]string{"name": filename})},
+		}))
+	}
+
+	if a.Inline {
+		// the content-id is the name without extension, so templates can reference cid:<name>
+		settings = append(settings, mail.SetHeader(map[string][]string{
+			"Content-ID": {"<" + a.Name + ">"},
+		}))
+		m.Embed(filename, settings...)
+		return
+	}
+
+	m.Attach(filename, settings...)
+}
+
+// RenderMessage renders the message exactly as Tx.Send would transmit it
+func RenderMessage(from string, to To, message Message, options ...SendOption) (b []byte, err error) {
+	m, err := newMessage(from, to, message, TxConfig{}.messageIDDomain(from), options)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err = m.WriteTo(&buf); err != nil {
+		return
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,558 @@
+package mail_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	stdmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestRenderMessage(t *testing.T) {
+	message := mail.Message{
+		Topic:       "topic",
+		Body:        "Hi",
+		ContentType: "text/plain",
+		Alternatives: []mail.Alternative{
+			{ContentType: "text/html", Body: "<p>Hi</p>"},
+		},
+		Attachments: []mail.Attachment{
+			{Name: "logo", Kind: "image/png", Content: pngContent},
+		},
+	}
+
+	b, err := mail.RenderMessage("test@example.de", mail.To{"ava@example.de"}, message, mail.ReplyTo("support@example.de"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered := string(b)
+	for _, want := range []string{
+		"From: test@example.de\r\n",
+		"To: ava@example.de\r\n",
+		"Reply-To: support@example.de\r\n",
+		"Message-Id: <",
+		"multipart/mixed",
+		"multipart/alternative",
+		"<p>Hi</p>",
+		`filename="logo.png"`,
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("expected %q in rendered message:\n%s", want, rendered)
+		}
+	}
+
+	data := sendToServer(t, mail.To{"ava@example.de"}, message, mail.ReplyTo("support@example.de"))
+	if !strings.Contains(data, `filename="logo.png"`) {
+		t.Errorf("expected sent message to contain the same attachment:\n%s", data)
+	}
+}
+
+func TestInlineImages(t *testing.T) {
+	tpl, err := mail.NewTemplate(
+		"topic",
+		`<img src="cid:logo">`,
+		mail.ContentType("text/html"),
+		mail.AllowAttachments("image/png"),
+		mail.WithInlineImages(mail.RawAttachment{Name: "logo", Content: pngContent}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(message.Attachments) != 1 || !message.Attachments[0].Inline {
+		t.Fatalf("expected inline attachment, got: %+v", message.Attachments)
+	}
+
+	b, err := mail.RenderMessage("test@example.de", mail.To{"ava@example.de"}, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered := string(b)
+	for _, want := range []string{
+		"multipart/related",
+		"Content-ID: <logo>",
+		`Content-Disposition: inline; filename="logo.png"`,
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("expected %q in rendered message:\n%s", want, rendered)
+		}
+	}
+
+	if strings.Contains(rendered, "multipart/mixed") {
+		t.Errorf("expected inline image not to be a regular attachment:\n%s", rendered)
+	}
+}
+
+func TestAttachmentFilenames(t *testing.T) {
+	tests := map[string]string{
+		"logo":             "logo.png",
+		"logo.png":         "logo.png",
+		"report.2024.xlsx": "report.2024.xlsx",
+		"scan.PNG":         "scan.PNG",
+	}
+
+	for name, want := range tests {
+		b, err := mail.RenderMessage("test@example.de", mail.To{"ava@example.de"}, mail.Message{
+			Topic:       "topic",
+			ContentType: "text/plain",
+			Attachments: []mail.Attachment{{Name: name, Kind: "image/png", Content: pngContent}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(b), `filename="`+want+`"`) {
+			t.Errorf("expected filename %q for %q:\n%s", want, name, b)
+		}
+	}
+}
+
+func TestAttachmentFilenamesWithoutExtension(t *testing.T) {
+	for kind, want := range map[string]string{
+		"application/octet-stream":       "data.bin",
+		"application/x-f9a-unknown-type": "data.bin",
+		"application/pdf":                "data.pdf",
+	} {
+		b, err := mail.RenderMessage("test@example.de", mail.To{"ava@example.de"}, mail.Message{
+			Topic:       "topic",
+			ContentType: "text/plain",
+			Attachments: []mail.Attachment{{Name: "data", Kind: kind, Content: []byte{0, 1, 2}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(b), `filename="`+want+`"`) {
+			t.Errorf("expected filename %q for %v:\n%s", want, kind, b)
+		}
+	}
+}
+
+func TestEmptyAttachment(t *testing.T) {
+	tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments("*/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, option := range map[string]mail.Option{
+		"raw":     mail.WithRawAttachments(mail.RawAttachment{Name: "empty", Content: []byte{}}),
+		"request": mail.WithAttachments(mail.RequestAttachments{{Name: "empty", Content: ""}}),
+		"reader":  mail.ReaderAttachment("empty", strings.NewReader(""), "text/plain"),
+	} {
+		_, err = tpl.Execute(nil, option)
+		if err == nil || !strings.Contains(err.Error(), "is empty") {
+			t.Errorf("expected empty %v attachment to be rejected, got %v", name, err)
+		}
+	}
+
+	msg, err := tpl.Execute(nil, mail.WithRawAttachments(mail.RawAttachment{Name: "data", Content: []byte{0, 1, 2}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kind := msg.Attachments[0].Kind; kind != "application/octet-stream" {
+		t.Errorf("expected octet-stream attachment, got %v", kind)
+	}
+}
+
+func TestAttachmentsWithSameName(t *testing.T) {
+	data := sendToServer(t, mail.To{"ava@example.de"}, mail.Message{
+		Topic:       "topic",
+		ContentType: "text/plain",
+		Attachments: []mail.Attachment{
+			{Name: "invoice", Kind: "application/pdf", Content: []byte("%PDF-1.4 first")},
+			{Name: "invoice", Kind: "application/pdf", Content: []byte("%PDF-1.4 second")},
+		},
+	})
+
+	if n := strings.Count(data, `filename="invoice.pdf"`); n != 2 {
+		t.Errorf("expected both attachments, got %d:\n%s", n, data)
+	}
+
+	for _, content := range []string{"first", "second"} {
+		encoded := base64.StdEncoding.EncodeToString([]byte("%PDF-1.4 " + content))
+		if !strings.Contains(data, encoded) {
+			t.Errorf("expected content of %v attachment:\n%s", content, data)
+		}
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	header := func(options ...mail.SendOption) stdmail.Header {
+		t.Helper()
+
+		b, err := mail.RenderMessage("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := stdmail.ReadMessage(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return msg.Header
+	}
+
+	h := header(mail.Unsubscribe("unsubscribe@example.de", "https://example.de/unsubscribe?id=42"))
+	if got := h.Get("List-Unsubscribe"); got != "<mailto:unsubscribe@example.de>, <https://example.de/unsubscribe?id=42>" {
+		t.Errorf("unexpected List-Unsubscribe: %q", got)
+	}
+	if got := h.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+		t.Errorf("unexpected List-Unsubscribe-Post: %q", got)
+	}
+
+	h = header(mail.Unsubscribe("mailto:unsubscribe@example.de", ""))
+	if got := h.Get("List-Unsubscribe"); got != "<mailto:unsubscribe@example.de>" {
+		t.Errorf("unexpected List-Unsubscribe: %q", got)
+	}
+	if got := h.Get("List-Unsubscribe-Post"); got != "" {
+		t.Errorf("expected no one-click without url, got %q", got)
+	}
+
+	for _, option := range []mail.SendOption{mail.Unsubscribe("", ""), mail.Unsubscribe("", "http://example.de")} {
+		if _, err := mail.RenderMessage("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"}, option); err == nil {
+			t.Error("expected error for invalid unsubscribe")
+		}
+	}
+}
+
+func TestWithPriority(t *testing.T) {
+	tests := map[mail.Priority][3]string{
+		mail.PriorityHigh:   {"1 (Highest)", "high", "urgent"},
+		mail.PriorityLow:    {"5 (Lowest)", "low", "non-urgent"},
+		mail.PriorityNormal: {"", "", ""},
+	}
+
+	for level, want := range tests {
+		b, err := mail.RenderMessage("test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"},
+			mail.WithPriority(mail.PriorityHigh), mail.WithPriority(level))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := stdmail.ReadMessage(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := [3]string{msg.Header.Get("X-Priority"), msg.Header.Get("Importance"), msg.Header.Get("Priority")}
+		if got != want {
+			t.Errorf("priority %v: expected headers %q, got %q", level, want, got)
+		}
+	}
+}
+
+func TestStreamAttachments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logo.png")
+	if err := os.WriteFile(path, pngContent, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	csv := "a,b\n1,2\n"
+	tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments("image/png", "text/csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := tpl.Execute(nil,
+		mail.FileAttachment("logo", path),
+		mail.ReaderAttachment("report.csv", strings.NewReader(csv), "text/csv"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(message.Attachments) != 2 || message.Attachments[0].Kind != "image/png" || message.Attachments[1].Kind != "text/csv" {
+		t.Fatalf("unexpected attachments: %+v", message.Attachments)
+	}
+
+	data := sendToServer(t, mail.To{"ava@example.de"}, message)
+	for _, want := range []string{
+		`filename="logo.png"`,
+		`filename="report.csv"`,
+		base64.StdEncoding.EncodeToString([]byte(csv)),
+		base64.StdEncoding.EncodeToString(pngContent),
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("expected %q in message:\n%s", want, data)
+		}
+	}
+
+	_, err = tpl.Execute(nil, mail.FileAttachment("missing", filepath.Join(t.TempDir(), "missing.png")))
+	if err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	_, err = tpl.Execute(nil, mail.ReaderAttachment("report", strings.NewReader("%PDF-1.4"), ""))
+	if err == nil {
+		t.Error("expected detected type of reader to be checked")
+	}
+}
+
+func TestStreamAttachmentMaxSize(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments("text/plain"), mail.MaxAttachmentSize(600))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := tpl.Execute(nil, mail.ReaderAttachment("big.txt", strings.NewReader(strings.Repeat("a", 1000)), "text/plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err == nil {
+		t.Fatal("expected error for oversized reader attachment")
+	}
+
+	if len(server.Envelopes()) != 0 {
+		t.Error("expected incomplete message not to be delivered")
+	}
+}
+
+func TestReaderAttachmentSentTwice(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := mail.NewTemplate("topic", "body", mail.AllowAttachments("text/plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := tpl.Execute(nil, mail.ReaderAttachment("report.txt", strings.NewReader("report"), "text/plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err == nil {
+		t.Fatal("expected error when the reader attachment is sent again")
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 1 {
+		t.Fatalf("expected only the first message to be delivered, got %v", len(envelopes))
+	}
+
+	if !strings.Contains(envelopes[0].Data, base64.StdEncoding.EncodeToString([]byte("report"))) {
+		t.Errorf("expected attachment content in message:\n%s", envelopes[0].Data)
+	}
+}
+
+func TestCharset(t *testing.T) {
+	tpl, err := mail.NewTemplate("Überweisung", "Grüße {{.}}", mail.Charset("ISO-8859-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := tpl.Execute("Jürgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := sendToServer(t, mail.To{"ava@example.de"}, message)
+	msg, err := stdmail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := msg.Header.Get("Subject"); got != "=?ISO-8859-1?q?=DCberweisung?=" {
+		t.Errorf("expected subject encoded in ISO-8859-1, got %q", got)
+	}
+
+	if got := msg.Header.Get("Content-Type"); got != "text/plain; charset=ISO-8859-1" {
+		t.Errorf("unexpected content type %q", got)
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(body)) != "Gr\xfc\xdfe J\xfcrgen" {
+		t.Errorf("expected body encoded in ISO-8859-1, got %q", body)
+	}
+
+	if _, err = mail.NewTemplate("topic", "body", mail.Charset("no-such-charset")); err == nil {
+		t.Error("expected error for unknown charset")
+	}
+
+	message.Body = "5 €"
+	server := newSMTPServer(t, nil)
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err == nil {
+		t.Error("expected error for characters the charset can't represent")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		encoding mail.TransferEncoding
+		expected string
+	}{
+		{"", "quoted-printable"},
+		{mail.EncodingQuotedPrintable, "quoted-printable"},
+		{mail.EncodingBase64, "base64"},
+		{mail.EncodingUnencoded, "8bit"},
+	}
+
+	for _, test := range tests {
+		tpl, err := mail.NewTemplate("topic", "body {{.}}", mail.Encoding(test.encoding))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message, err := tpl.Execute("Jürgen")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := sendToServer(t, mail.To{"ava@example.de"}, message)
+		msg, err := stdmail.ReadMessage(strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := msg.Header.Get("Content-Transfer-Encoding"); got != test.expected {
+			t.Errorf("expected encoding %q for %q, got %q", test.expected, test.encoding, got)
+		}
+	}
+
+	if _, err := mail.NewTemplate("topic", "body", mail.Encoding("7bit")); err == nil {
+		t.Error("expected error for unknown encoding")
+	}
+}
+
+func TestWriteEML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mails", "welcome.eml")
+
+	err := mail.WriteEML(path, "test@example.de", mail.To{"ava@example.de"}, mail.Message{
+		Topic:        "topic",
+		Body:         "Hi",
+		ContentType:  "text/plain",
+		Alternatives: []mail.Alternative{{ContentType: "text/html", Body: "<b>Hi</b>"}},
+		Attachments:  []mail.Attachment{{Name: "logo", Kind: "image/png", Content: pngContent}},
+	}, mail.Header("Message-Id", "<welcome@example.de>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := stdmail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Header.Get("Subject") != "topic" || msg.Header.Get("Message-Id") != "<welcome@example.de>" {
+		t.Errorf("unexpected headers: %v", msg.Header)
+	}
+
+	for _, want := range []string{"multipart/alternative", "<b>Hi</b>", `filename="logo.png"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in eml:\n%s", want, data)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err = os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err = mail.WriteEML(filepath.Join(file, "welcome.eml"), "test@example.de", mail.To{"ava@example.de"}, mail.Message{Topic: "topic"})
+	if err == nil {
+		t.Error("expected error for path below a file")
+	}
+}
+
+func TestRegisterExtension(t *testing.T) {
+	filename := func() string {
+		t.Helper()
+
+		b, err := mail.RenderMessage("test@example.de", mail.To{"ava@example.de"}, mail.Message{
+			Topic:       "topic",
+			ContentType: "text/plain",
+			Attachments: []mail.Attachment{{Name: "report", Kind: "text/csv; charset=utf-8", Content: []byte("a,b\n")}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := stdmail.ReadMessage(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		r := multipart.NewReader(msg.Body, params["boundary"])
+		for {
+			part, err := r.NextPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if name := part.FileName(); name != "" {
+				return name
+			}
+		}
+	}
+
+	if err := mail.RegisterExtension("text/csv", "csv"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		mail.RegisterExtension("text/csv", "")
+	})
+
+	if got := filename(); got != "report.csv" {
+		t.Errorf("expected registered extension, got %v", got)
+	}
+
+	if err := mail.RegisterExtension("text/csv", ".tsv"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := filename(); got != "report.tsv" {
+		t.Errorf("expected overridden extension, got %v", got)
+	}
+
+	if err := mail.RegisterExtension("", ".txt"); err == nil {
+		t.Error("expected error for invalid mime-type")
+	}
+}
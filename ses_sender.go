@@ -0,0 +1,103 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+var _ ConfigurableSender = &SESSender{}
+
+// SESClient sends raw mails through Amazon SES. It's satisfied by a small adapter
+// around SendRawEmail of the aws sdk, so this package doesn't depend on the sdk:
+//
+//	func (a adapter) SendRawEmail(ctx context.Context, source string, destinations []string, raw []byte) (string, error) {
+//		out, err := a.client.SendRawEmail(ctx, &ses.SendRawEmailInput{
+//			Source:       aws.String(source),
+//			Destinations: destinations,
+//			RawMessage:   &types.RawMessage{Data: raw},
+//		})
+//		if err != nil {
+//			return "", err
+//		}
+//		return aws.ToString(out.MessageId), nil
+//	}
+type SESClient interface {
+	SendRawEmail(ctx context.Context, source string, destinations []string, raw []byte) (messageID string, err error)
+}
+
+// SESSender sends the fully rendered mime message, including attachments and
+// alternatives, through Amazon SES.
+type SESSender struct {
+	Client SESClient
+
+	cfg atomic.Value
+}
+
+// NewSESSender creates a sender using client, cfg.Host is used as Message-ID domain
+func NewSESSender(client SESClient, cfg TxConfig) *SESSender {
+	s := &SESSender{Client: client}
+	s.UpdateTxConfig(cfg)
+
+	return s
+}
+
+// UpdateTxConfig is safe for concurrent use
+func (s *SESSender) UpdateTxConfig(cfg TxConfig) {
+	s.cfg.Store(cfg)
+}
+
+// Send sends message
+func (s *SESSender) Send(from string, to To, message Message, options ...SendOption) (err error) {
+	_, err = s.SendContext(context.Background(), from, to, message, options...)
+	return
+}
+
+// SendContext sends message and returns the Message-ID assigned by SES,
+// or the generated one if SES didn't return any
+func (s *SESSender) SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error) {
+	if s.Client == nil {
+		err = errors.New("ses sender has no client")
+		return
+	}
+
+	cfg, _ := s.cfg.Load().(TxConfig)
+
+	m, err := newMessage(from, to, message, cfg.messageIDDomain(from), options)
+	if err != nil {
+		return
+	}
+	messageID = m.GetHeader("Message-Id")[0]
+
+	var buf bytes.Buffer
+	if _, err = m.WriteTo(&buf); err != nil {
+		return
+	}
+
+	opts := sendOptions{}
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	if opts.normalize {
+		to = opts.normalizeRecipients(to)
+	}
+
+	destinations := make([]string, 0, len(to)+len(opts.cc)+len(opts.bcc))
+	for _, addrs := range [][]string{to, opts.cc, opts.bcc} {
+		for _, addr := range addrs {
+			destinations = append(destinations, bareAddress(addr))
+		}
+	}
+
+	id, err := s.Client.SendRawEmail(ctx, envelopeFrom(m, from), destinations, buf.Bytes())
+	if err != nil {
+		return
+	}
+
+	if id != "" {
+		messageID = id
+	}
+
+	return
+}
@@ -0,0 +1,68 @@
+package mail_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+type fakeSES struct {
+	source       string
+	destinations []string
+	raw          []byte
+	err          error
+}
+
+func (f *fakeSES) SendRawEmail(ctx context.Context, source string, destinations []string, raw []byte) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+
+	f.source, f.destinations, f.raw = source, destinations, raw
+	return "ses-id", nil
+}
+
+func TestSESSender(t *testing.T) {
+	client := &fakeSES{}
+	var sender mail.Sender = mail.NewSESSender(client, mail.TxConfig{Host: "example.de"})
+
+	message := mail.Message{
+		Topic:        "topic",
+		Body:         "Hi",
+		ContentType:  "text/plain",
+		Alternatives: []mail.Alternative{{ContentType: "text/html", Body: "<b>Hi</b>"}},
+		Attachments:  []mail.Attachment{{Name: "image", Kind: "image/png", Content: pngContent}},
+	}
+
+	id, err := sender.SendContext(context.Background(), "test@example.de", mail.To{"ava@example.de"}, message, mail.Bcc(mail.Address("Ben", "ben@example.de")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != "ses-id" {
+		t.Errorf("expected id of ses, got: %v", id)
+	}
+
+	if client.source != "test@example.de" || strings.Join(client.destinations, ",") != "ava@example.de,ben@example.de" {
+		t.Errorf("unexpected envelope: %v %v", client.source, client.destinations)
+	}
+
+	raw := string(client.raw)
+	for _, want := range []string{"multipart/mixed", "multipart/alternative", "text/html", `filename="image.png"`} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("expected %q in raw message:\n%s", want, raw)
+		}
+	}
+
+	if strings.Contains(raw, "ben@example.de") {
+		t.Errorf("bcc must not be part of the raw message:\n%s", raw)
+	}
+
+	client.err = errors.New("throttled")
+	if err = sender.Send("test@example.de", mail.To{"ava@example.de"}, message); err == nil {
+		t.Error("expected error of client")
+	}
+}
@@ -0,0 +1,102 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"sync/atomic"
+)
+
+var _ ConfigurableSender = &StdSMTPSender{}
+
+// StdSMTPSender sends the fully rendered mime message with smtp.SendMail of the standard library,
+// e.g. for environments where the connection handling of Tx doesn't work.
+//
+// User and Password are used for PLAIN authentication, unless AllowUnauthenticated is set.
+// smtp.SendMail upgrades the connection with STARTTLS when the server supports it and verifies
+// the certificate of Host, so ssl, TLSConfig, InsecureSkipVerify, Timeout and XOAUTH2 are not supported.
+type StdSMTPSender struct {
+	cfg atomic.Value
+}
+
+// NewStdSMTPSender creates a sender using smtp.SendMail with cfg
+func NewStdSMTPSender(cfg TxConfig) *StdSMTPSender {
+	s := &StdSMTPSender{}
+	s.UpdateTxConfig(cfg)
+
+	return s
+}
+
+// UpdateTxConfig is safe for concurrent use
+func (s *StdSMTPSender) UpdateTxConfig(cfg TxConfig) {
+	s.cfg.Store(cfg)
+}
+
+// Send sends message
+func (s *StdSMTPSender) Send(from string, to To, message Message, options ...SendOption) (err error) {
+	_, err = s.SendContext(context.Background(), from, to, message, options...)
+	return
+}
+
+// SendContext sends message and returns its Message-ID. smtp.SendMail can't be canceled,
+// so ctx is only checked before the message is sent.
+func (s *StdSMTPSender) SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error) {
+	cfg, ok := s.cfg.Load().(TxConfig)
+	if !ok {
+		err = errors.New("std smtp sender is not configured, yet")
+		return
+	}
+
+	if err = cfg.Validate(); err != nil {
+		err = fmt.Errorf("invalid config: %v", err)
+		return
+	}
+
+	if cfg.Encryption == EncryptionSSL || cfg.port() == 465 || cfg.usesXOAuth2() {
+		err = errors.New("std smtp sender supports neither ssl nor xoauth2, use Tx")
+		return
+	}
+
+	m, err := newMessage(from, to, message, cfg.messageIDDomain(from), options)
+	if err != nil {
+		return
+	}
+	messageID = m.GetHeader("Message-Id")[0]
+
+	var buf bytes.Buffer
+	if _, err = m.WriteTo(&buf); err != nil {
+		return
+	}
+
+	opts := sendOptions{}
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	if opts.normalize {
+		to = opts.normalizeRecipients(to)
+	}
+
+	recipients := make([]string, 0, len(to)+len(opts.cc)+len(opts.bcc))
+	for _, addrs := range [][]string{to, opts.cc, opts.bcc} {
+		for _, addr := range addrs {
+			recipients = append(recipients, bareAddress(addr))
+		}
+	}
+
+	var auth smtp.Auth
+	if !cfg.AllowUnauthenticated {
+		auth = smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.port()))
+	err = smtp.SendMail(addr, auth, envelopeFrom(m, bareAddress(from)), recipients, buf.Bytes())
+	return
+}
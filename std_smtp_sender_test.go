@@ -0,0 +1,54 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestStdSMTPSender(t *testing.T) {
+	server := newSMTPServer(t, map[string]string{"EHLO": "250-localhost\r\n250 AUTH PLAIN"})
+
+	var sender mail.Sender = mail.NewStdSMTPSender(server.Config())
+
+	message := mail.Message{
+		Topic:        "topic",
+		Body:         "Hi",
+		ContentType:  "text/plain",
+		Alternatives: []mail.Alternative{{ContentType: "text/html", Body: "<b>Hi</b>"}},
+		Attachments:  []mail.Attachment{{Name: "image", Kind: "image/png", Content: pngContent}},
+	}
+
+	err := sender.Send("Acme <test@example.de>", mail.To{"Ava <ava@example.de>"}, message, mail.Bcc("ben@example.de"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelopes := server.Envelopes()
+	if len(envelopes) != 1 {
+		t.Fatalf("expected one message, got %v", len(envelopes))
+	}
+
+	envelope := envelopes[0]
+	if envelope.From != "test@example.de" || strings.Join(envelope.To, ",") != "ava@example.de,ben@example.de" {
+		t.Errorf("unexpected envelope: %v %v", envelope.From, envelope.To)
+	}
+
+	for _, want := range []string{"Subject: topic", "<b>Hi</b>", `filename="image.png"`} {
+		if !strings.Contains(envelope.Data, want) {
+			t.Errorf("expected %q in message:\n%s", want, envelope.Data)
+		}
+	}
+
+	if commands := server.Commands(); !strings.HasPrefix(strings.Join(commands, "\n"), "EHLO") || !strings.Contains(strings.Join(commands, "\n"), "AUTH PLAIN") {
+		t.Errorf("expected plain authentication, got: %v", commands)
+	}
+
+	cfg := server.Config()
+	cfg.Encryption = mail.EncryptionSSL
+	cfg.Port = 465
+	if err = mail.NewStdSMTPSender(cfg).Send("test@example.de", mail.To{"ava@example.de"}, message); err == nil {
+		t.Error("expected error for ssl")
+	}
+}
@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+// streamAttachment is an attachment whose content is streamed when the message is sent
+type streamAttachment struct {
+	name string
+	kind string
+	// path of a FileAttachment
+	path string
+	// r of a ReaderAttachment
+	r io.Reader
+}
+
+// FileAttachment attaches the file at path, it's streamed from disk when the message is sent.
+// Only the first 512 bytes are read to detect the mime type when the template is executed.
+func FileAttachment(name, path string) Option {
+	return func(tpl *Template) {
+		tpl.streamAttachments = append(tpl.streamAttachments, streamAttachment{name: name, path: path})
+	}
+}
+
+// ReaderAttachment attaches the content of r, it's streamed when the message is sent.
+// The mime type is detected from the first 512 bytes when kind is empty.
+// r is read once, so the message can only be sent once, sending it again, e.g. with a retry,
+// fails instead of sending an empty attachment.
+func ReaderAttachment(name string, r io.Reader, kind string) Option {
+	return func(tpl *Template) {
+		tpl.streamAttachments = append(tpl.streamAttachments, streamAttachment{name: name, kind: kind, r: r})
+	}
+}
+
+// errAttachmentTooLarge is returned while streaming a reader attachment exceeding the max size
+var errAttachmentTooLarge = errors.New("attachment exceeds max size")
+
+// maxReader fails with errAttachmentTooLarge when more than max bytes are read
+type maxReader struct {
+	r   io.Reader
+	max int64
+	n   int64
+}
+
+func (r *maxReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.max {
+		return n, errAttachmentTooLarge
+	}
+
+	return
+}
+
+// detectKind returns kind or the mime type detected from head and checks it against allowed,
+// and against head when verify is set
+func detectKind(allowed map[string]struct{}, verify bool, name, kind string, head []byte) (string, error) {
+	if kind == "" {
+		kind = http.DetectContentType(head)
+	} else if _, _, err := mime.ParseMediaType(kind); err != nil {
+		return "", fmt.Errorf("attachment %v has invalid MIME Type %q: %v", name, kind, err)
+	}
+
+	if !typeAllowed(allowed, kind) {
+		return "", fmt.Errorf("MIME Type %v is not allowed", kind)
+	}
+
+	if verify {
+		if err := verifyKind(name, kind, head); err != nil {
+			return "", err
+		}
+	}
+
+	return kind, nil
+}
+
+func processStreamAttachments(allowed map[string]struct{}, maxSize int64, verify bool, streams []streamAttachment) (aa []Attachment, err error) {
+	for _, s := range streams {
+		var a Attachment
+		if s.r != nil {
+			a, err = readerAttachment(allowed, maxSize, verify, s)
+		} else {
+			a, err = fileAttachment(allowed, maxSize, verify, s)
+		}
+		if err != nil {
+			return
+		}
+
+		aa = append(aa, a)
+	}
+
+	return
+}
+
+func fileAttachment(allowed map[string]struct{}, maxSize int64, verify bool, s streamAttachment) (a Attachment, err error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		err = fmt.Errorf("couldn't open attachment %v: %v", s.name, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	if info.Size() == 0 {
+		err = fmt.Errorf("attachment %v is empty", s.name)
+		return
+	}
+
+	if maxSize > 0 && info.Size() > maxSize {
+		err = fmt.Errorf("attachment %v exceeds max size of %d bytes", s.name, maxSize)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		err = fmt.Errorf("couldn't read attachment %v: %v", s.name, err)
+		return
+	}
+
+	kind, err := detectKind(allowed, verify, s.name, s.kind, head[:n])
+	if err != nil {
+		return
+	}
+
+	path := s.path
+	return Attachment{
+		Name: s.name,
+		Kind: kind,
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+		size: info.Size(),
+	}, nil
+}
+
+func readerAttachment(allowed map[string]struct{}, maxSize int64, verify bool, s streamAttachment) (a Attachment, err error) {
+	br := bufio.NewReaderSize(s.r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		err = fmt.Errorf("couldn't read attachment %v: %v", s.name, err)
+		return
+	}
+
+	if len(head) == 0 {
+		err = fmt.Errorf("attachment %v is empty", s.name)
+		return
+	}
+
+	kind, err := detectKind(allowed, verify, s.name, s.kind, head)
+	if err != nil {
+		return
+	}
+
+	var r io.Reader = br
+	if maxSize > 0 {
+		r = &maxReader{r: br, max: maxSize}
+	}
+
+	name := s.name
+	var opened atomic.Bool
+	return Attachment{
+		Name: s.name,
+		Kind: kind,
+		Open: func() (io.ReadCloser, error) {
+			if opened.Swap(true) {
+				return nil, fmt.Errorf("attachment %v was already read, a reader attachment can only be sent once", name)
+			}
+
+			return io.NopCloser(r), nil
+		},
+	}, nil
+}
+
+// content returns the content of a, streamed attachments are read completely
+func (a Attachment) content() ([]byte, error) {
+	if a.Open == nil {
+		return a.Content, nil
+	}
+
+	rc, err := a.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	if _, err = io.Copy(&buf, rc); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+)
+
+// TeeRecorder sends mails with Sender and records them with Recorder, e.g. to deliver
+// and inspect mails in staging. Mails are recorded whether sending succeeded or not.
+type TeeRecorder struct {
+	Sender   Sender
+	Recorder *MemRecorder
+}
+
+var _ Recorder = &TeeRecorder{}
+
+// NewTeeRecorder returns a TeeRecorder sending with sender and recording in a new MemRecorder
+func NewTeeRecorder(sender Sender) *TeeRecorder {
+	return &TeeRecorder{Sender: sender, Recorder: &MemRecorder{}}
+}
+
+func (t *TeeRecorder) Send(from string, to To, message Message, options ...SendOption) (err error) {
+	_, err = t.SendContext(context.Background(), from, to, message, options...)
+	return
+}
+
+// SendContext sends the mail with Sender and records it with the Message-ID of Sender
+func (t *TeeRecorder) SendContext(ctx context.Context, from string, to To, message Message, options ...SendOption) (messageID string, err error) {
+	messageID, err = t.Sender.SendContext(ctx, from, to, message, options...)
+
+	recordOptions := options
+	if messageID != "" {
+		recordOptions = append(append([]SendOption{}, options...), Header("Message-Id", messageID))
+	}
+
+	t.Recorder.SendContext(context.Background(), from, to, message, recordOptions...)
+
+	return
+}
+
+// Seen reports whether Recorder recorded m
+func (t *TeeRecorder) Seen(m Mail) (ok bool, err error) {
+	return t.Recorder.Seen(m)
+}
+
+// SeenLoose reports whether Recorder recorded m with its recipients in any order
+func (t *TeeRecorder) SeenLoose(m Mail) (ok bool, err error) {
+	return t.Recorder.SeenLoose(m)
+}
+
+// UpdateTxConfig updates the config of Recorder and of Sender, when it's a ConfigurableSender
+func (t *TeeRecorder) UpdateTxConfig(cfg TxConfig) {
+	if s, ok := t.Sender.(ConfigurableSender); ok {
+		s.UpdateTxConfig(cfg)
+	}
+
+	t.Recorder.UpdateTxConfig(cfg)
+}
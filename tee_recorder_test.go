@@ -0,0 +1,54 @@
+package mail_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/f9a/mail"
+)
+
+func TestTeeRecorder(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tee := mail.NewTeeRecorder(m)
+	message := mail.Message{Topic: "topic", Body: "body", ContentType: "text/plain"}
+	id, err := tee.SendContext(context.Background(), "test@example.de", mail.To{"ava@example.de"}, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(server.Envelopes()); n != 1 {
+		t.Fatalf("expected the mail to be delivered, got %v messages", n)
+	}
+
+	ok, err := tee.Seen(mail.Mail{From: "test@example.de", To: mail.To{"ava@example.de"}, Message: message})
+	if err != nil || !ok {
+		t.Errorf("expected the mail to be recorded, got %v, %v", ok, err)
+	}
+
+	last, _ := tee.Recorder.Last()
+	if id == "" || last.MessageID != id || !strings.Contains(server.Envelopes()[0].Data, id) {
+		t.Errorf("expected the recorded Message-ID of the delivered mail, got %q", last.MessageID)
+	}
+
+	rejecting := newSMTPServer(t, map[string]string{"RCPT": "550 no such user"})
+	m, err = mail.Dial(rejecting.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tee = mail.NewTeeRecorder(m)
+	if err = tee.Send("test@example.de", mail.To{"ava@example.de"}, message); err == nil {
+		t.Fatal("expected error of the rejected recipient")
+	}
+
+	if tee.Recorder.Len() != 1 {
+		t.Error("expected the failed mail to be recorded")
+	}
+}
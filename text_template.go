@@ -0,0 +1,54 @@
+package mail
+
+import (
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// emptyNoValueFunc is added to every printed pipeline of text templates, like html/template adds its escapers
+const emptyNoValueFunc = "_mail_emptyNoValue"
+
+// emptyNoValue prints missing values empty, like html/template does, instead of "<no value>"
+func emptyNoValue(v interface{}) interface{} {
+	if v == nil {
+		return ""
+	}
+
+	return v
+}
+
+// printEmptyNoValue rewrites all templates associated with t to print missing values empty
+func printEmptyNoValue(t *texttemplate.Template) {
+	for _, associated := range t.Templates() {
+		if associated.Tree != nil {
+			rewriteNoValue(associated.Tree, associated.Tree.Root)
+		}
+	}
+}
+
+func rewriteNoValue(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			rewriteNoValue(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		ident := parse.NewIdentifier(emptyNoValueFunc).SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}})
+	case *parse.IfNode:
+		rewriteNoValue(tree, n.List)
+		rewriteNoValue(tree, n.ElseList)
+	case *parse.RangeNode:
+		rewriteNoValue(tree, n.List)
+		rewriteNoValue(tree, n.ElseList)
+	case *parse.WithNode:
+		rewriteNoValue(tree, n.List)
+		rewriteNoValue(tree, n.ElseList)
+	}
+}
@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/f9a/mail"
+
+// startSpan starts a span with the tracer provider of the span in ctx.
+// It's a no-op span when ctx has no span.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+}
+
+func endSpan(span trace.Span, info SendInfo, err error) {
+	span.SetAttributes(
+		attribute.Int("mail.recipients", info.Recipients),
+		attribute.Int("mail.subject_length", len(info.Subject)),
+		attribute.Int("mail.attachments", info.Attachments),
+	)
+
+	if info.MessageID != "" {
+		span.SetAttributes(attribute.String("mail.message_id", info.MessageID))
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,71 @@
+package mail_test
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/f9a/mail"
+)
+
+func TestSendSpan(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	m, err := mail.Dial(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+	message := mail.Message{Topic: "topic", Body: "Hi", ContentType: "text/plain"}
+	if _, err = m.SendContext(ctx, "test@example.de", mail.To{"ava@example.de"}, message, mail.Cc("ben@example.de")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.SendContext(ctx, "test@example.de", mail.To{"not-an-address"}, message); err == nil {
+		t.Fatal("expected error for invalid address")
+	}
+	parent.End()
+
+	// sends without a span in the context are not traced
+	if err = m.Send("test@example.de", mail.To{"ava@example.de"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 2 send spans and the parent, got %d", len(spans))
+	}
+
+	sent := spans[0]
+	if sent.Name() != "mail.Send" || sent.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("unexpected span %v with parent %v", sent.Name(), sent.Parent().SpanID())
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range sent.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+
+	if attrs["mail.recipients"].AsInt64() != 2 ||
+		attrs["mail.subject_length"].AsInt64() != 5 ||
+		attrs["mail.attachments"].AsInt64() != 0 ||
+		attrs["server.address"].AsString() != server.Config().Host {
+		t.Errorf("unexpected attributes: %v", sent.Attributes())
+	}
+
+	if sent.Status().Code == codes.Error {
+		t.Errorf("expected successful span, got %v", sent.Status())
+	}
+
+	if failed := spans[1]; failed.Status().Code != codes.Error || len(failed.Events()) == 0 {
+		t.Errorf("expected failed span with recorded error, got %v", failed.Status())
+	}
+}
@@ -0,0 +1,100 @@
+package mail
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultURLTimeout is the timeout of URLAttachment when no URLTimeout is given
+const DefaultURLTimeout = 30 * time.Second
+
+type urlOptions struct {
+	client  *http.Client
+	timeout time.Duration
+	maxSize int64
+}
+
+// URLOption configures URLAttachment
+type URLOption func(*urlOptions)
+
+// URLClient sets the http client used to fetch the attachment, http.DefaultClient is used by default.
+func URLClient(client *http.Client) URLOption {
+	return func(o *urlOptions) {
+		o.client = client
+	}
+}
+
+// URLTimeout limits the time to fetch the attachment, defaults to DefaultURLTimeout.
+// Zero or less disables the timeout, then only ctx limits the request.
+func URLTimeout(timeout time.Duration) URLOption {
+	return func(o *urlOptions) {
+		o.timeout = timeout
+	}
+}
+
+// URLMaxSize fails URLAttachment when the fetched content exceeds max bytes
+func URLMaxSize(max int64) URLOption {
+	return func(o *urlOptions) {
+		o.maxSize = max
+	}
+}
+
+// URLAttachment fetches the content at url and returns it as RequestAttachment with the
+// detected mime type, from the Content-Type of the response or the content itself.
+// The returned attachment can be passed to the template with WithAttachments.
+func URLAttachment(ctx context.Context, name, url string, opts ...URLOption) (a RequestAttachment, err error) {
+	o := urlOptions{client: http.DefaultClient, timeout: DefaultURLTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		err = fmt.Errorf("couldn't create request for attachment %v: %v", name, err)
+		return
+	}
+
+	res, err := o.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("couldn't fetch attachment %v: %v", name, err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("couldn't fetch attachment %v: server responded with %v", name, res.Status)
+		return
+	}
+
+	var body io.Reader = res.Body
+	if o.maxSize > 0 {
+		body = &maxReader{r: res.Body, max: o.maxSize}
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		err = fmt.Errorf("couldn't read attachment %v: %v", name, err)
+		return
+	}
+
+	kind := res.Header.Get("Content-Type")
+	if kind == "" || kind == "application/octet-stream" {
+		kind = http.DetectContentType(content)
+	}
+
+	return RequestAttachment{
+		Name:    name,
+		Content: base64.StdEncoding.EncodeToString(content),
+		Kind:    kind,
+	}, nil
+}
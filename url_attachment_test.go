@@ -0,0 +1,52 @@
+package mail_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f9a/mail"
+)
+
+func TestURLAttachment(t *testing.T) {
+	pdf := "%PDF-1.4 report"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/report.pdf":
+			w.Write([]byte(pdf))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a, err := mail.URLAttachment(context.Background(), "report.pdf", server.URL+"/report.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Name != "report.pdf" || a.Kind != "application/pdf" || a.Content != base64.StdEncoding.EncodeToString([]byte(pdf)) {
+		t.Errorf("unexpected attachment: %+v", a)
+	}
+
+	_, err = mail.URLAttachment(context.Background(), "missing", server.URL+"/missing")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	_, err = mail.URLAttachment(context.Background(), "report.pdf", server.URL+"/report.pdf", mail.URLMaxSize(4))
+	if err == nil {
+		t.Error("expected error for content exceeding max size")
+	}
+
+	_, err = mail.URLAttachment(context.Background(), "slow", server.URL+"/slow", mail.URLTimeout(20*time.Millisecond))
+	if err == nil {
+		t.Error("expected timeout error")
+	}
+}
@@ -0,0 +1,132 @@
+package mail
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// VerifyAttachmentType rejects attachments whose content doesn't match their Kind or the
+// extension of their name, e.g. a zip named report.pdf. The content is detected with
+// http.DetectContentType, so only types it recognizes can be told apart: office documents
+// are accepted as zip files and types it can't detect are accepted for any unknown content.
+func VerifyAttachmentType() Option {
+	return func(tpl *Template) {
+		tpl.verifyAttachmentType = true
+	}
+}
+
+// sniffedTypes are the types http.DetectContentType recognizes, content declared as one
+// of them must be detected as it
+var sniffedTypes = map[string]struct{}{
+	"application/pdf":               {},
+	"application/postscript":        {},
+	"application/zip":               {},
+	"application/x-gzip":            {},
+	"application/x-rar-compressed":  {},
+	"application/ogg":               {},
+	"application/wasm":              {},
+	"application/vnd.ms-fontobject": {},
+	"image/bmp":                     {},
+	"image/gif":                     {},
+	"image/jpeg":                    {},
+	"image/png":                     {},
+	"image/webp":                    {},
+	"image/x-icon":                  {},
+	"audio/aiff":                    {},
+	"audio/basic":                   {},
+	"audio/midi":                    {},
+	"audio/mpeg":                    {},
+	"audio/wave":                    {},
+	"video/avi":                     {},
+	"video/mp4":                     {},
+	"video/webm":                    {},
+	"font/collection":               {},
+	"font/otf":                      {},
+	"font/ttf":                      {},
+	"font/woff":                     {},
+	"font/woff2":                    {},
+}
+
+// typeAliases maps common names of types to the names http.DetectContentType uses
+var typeAliases = map[string]string{
+	"application/gzip":             "application/x-gzip",
+	"application/vnd.rar":          "application/x-rar-compressed",
+	"application/x-zip-compressed": "application/zip",
+	"audio/ogg":                    "application/ogg",
+	"video/ogg":                    "application/ogg",
+	"audio/wav":                    "audio/wave",
+	"audio/x-wav":                  "audio/wave",
+	"audio/mp3":                    "audio/mpeg",
+	"image/jpg":                    "image/jpeg",
+	"image/vnd.microsoft.icon":     "image/x-icon",
+	"video/x-msvideo":              "video/avi",
+}
+
+func canonicalType(kind string) string {
+	mediaType, _, err := mime.ParseMediaType(kind)
+	if err != nil {
+		return kind
+	}
+
+	if alias, ok := typeAliases[mediaType]; ok {
+		return alias
+	}
+
+	return mediaType
+}
+
+// zipBased reports whether content of mediaType is a zip file, like office documents
+func zipBased(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "application/vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(mediaType, "application/vnd.oasis.opendocument.") ||
+		strings.HasSuffix(mediaType, "+zip") ||
+		mediaType == "application/java-archive"
+}
+
+// textBased reports whether content of mediaType is text
+func textBased(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/json" ||
+		mediaType == "application/xml" ||
+		mediaType == "application/javascript"
+}
+
+// kindMatches reports whether content detected as detected can be of type declared
+func kindMatches(declared, detected string) bool {
+	declared, detected = canonicalType(declared), canonicalType(detected)
+
+	switch {
+	case declared == detected:
+		return true
+	case detected == "application/zip" && zipBased(declared):
+		return true
+	case strings.HasPrefix(detected, "text/") && textBased(declared):
+		return true
+	case detected == "application/octet-stream" || detected == "text/plain":
+		// the content is unknown, only types which would have been detected are refused
+		_, sniffed := sniffedTypes[declared]
+		return !sniffed
+	default:
+		return false
+	}
+}
+
+// verifyKind checks that head, the start of the content, matches kind and the extension of name
+func verifyKind(name, kind string, head []byte) error {
+	detected := http.DetectContentType(head)
+
+	if !kindMatches(kind, detected) {
+		return fmt.Errorf("attachment %v is declared as %v, but its content is %v", name, kind, canonicalType(detected))
+	}
+
+	if byExtension := mime.TypeByExtension(filepath.Ext(name)); byExtension != "" && !kindMatches(byExtension, detected) {
+		return fmt.Errorf("attachment %v has the extension of %v, but its content is %v", name, canonicalType(byExtension), canonicalType(detected))
+	}
+
+	return nil
+}